@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default UDP port radiosonde_auto_rx broadcasts its payload summaries on
+const defaultAutoRXPort = 55673
+
+// AutoRXPayloadSummary is the PAYLOAD_SUMMARY message broadcast over UDP by radiosonde_auto_rx.
+// Not every version of auto_rx sends every field, so anything missing is left at its zero value.
+type AutoRXPayloadSummary struct {
+	Type         string   `json:"type"`
+	Station      string   `json:"station"`
+	Callsign     string   `json:"callsign"`
+	Latitude     float64  `json:"latitude"`
+	Longitude    float64  `json:"longitude"`
+	Altitude     float64  `json:"altitude"`
+	Speed        float64  `json:"speed"` // Horizontal speed in kph
+	Heading      float64  `json:"heading"`
+	Time         string   `json:"time"` // HH:MM:SS (UTC)
+	Comment      string   `json:"comment"`
+	Model        string   `json:"model"`
+	Subtype      string   `json:"subtype"`
+	Freq         string   `json:"freq"` // e.g. "402.500 MHz"
+	FreqFloat    float64  `json:"freq_float"`
+	Temp         *float64 `json:"temp"`
+	Humidity     float64  `json:"humidity"`
+	Frame        int      `json:"frame"`
+	BurstTimer   int      `json:"bt"`
+	Sats         int      `json:"sats"`
+	Batt         float64  `json:"batt"`
+	VelV         float64  `json:"vel_v"`
+	VelH         float64  `json:"vel_h"`
+	Snr          float64  `json:"snr"`
+	SdrDeviceIdx string   `json:"sdr_device_idx"`
+}
+
+// autorxTypes maps the auto_rx sonde model prefix to the SondeHub type and manufacturer
+var autorxTypes = map[string][2]string{
+	"RS41":   {"RS41", "Vaisala"},
+	"RS92":   {"RS92", "Vaisala"},
+	"DFM":    {"DFM", "Graw"},
+	"M10":    {"M10", "Meteomodem"},
+	"M20":    {"M20", "Meteomodem"},
+	"IMET54": {"iMet-54", "Intermet Systems"},
+	"IMET":   {"iMet-4", "Intermet Systems"},
+	"LMS6":   {"LMS6", "Lockheed Martin"},
+	"MK2LMS": {"LMS6", "Lockheed Martin"},
+	"MEISEI": {"IMS100", "Meisei"},
+	"MRZ":    {"MRZ", "Meteo-Radiy"},
+	"MTS01":  {"MTS01", "Meteosis"},
+	"WXR301": {"WxR-301D", "Weathex"},
+}
+
+// ToSHPacket normalizes an auto_rx payload summary into the same SHPacket the SondeHub feed produces
+func (s AutoRXPayloadSummary) ToSHPacket(received time.Time) SHPacket {
+	model := strings.ToUpper(strings.ReplaceAll(s.Model, "-", ""))
+	shType, manufacturer := s.Model, ""
+	// Match the longest known prefix, so IMET54 wins over IMET
+	matched := ""
+	for prefix, v := range autorxTypes {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+			shType, manufacturer = v[0], v[1]
+		}
+	}
+
+	// SondeHub only keeps the type prefix in the serial for Vaisala sondes, auto_rx always adds it
+	serial := s.Callsign
+	if manufacturer != "Vaisala" {
+		if idx := strings.Index(serial, "-"); idx >= 0 {
+			serial = serial[idx+1:]
+		}
+	}
+
+	freq := s.FreqFloat
+	if freq == 0 {
+		fmt.Sscanf(s.Freq, "%f", &freq)
+	}
+
+	velH := s.VelH
+	if velH == 0 {
+		velH = s.Speed / 3.6
+	}
+
+	// auto_rx only gives us a time of day, so we attach it to today's date (or yesterday's around midnight)
+	datetime := received
+	if t, err := time.Parse("15:04:05", s.Time); err == nil {
+		datetime = time.Date(received.Year(), received.Month(), received.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+		if datetime.Sub(received) > 12*time.Hour {
+			datetime = datetime.AddDate(0, 0, -1)
+		}
+	}
+
+	return SHPacket{
+		SoftwareName:     "radiosonde_auto_rx",
+		UploaderCallsign: s.Station,
+		TimeReceived:     received,
+		Datetime:         datetime,
+		Manufacturer:     manufacturer,
+		Type:             shType,
+		Serial:           serial,
+		Subtype:          s.Subtype,
+		Frame:            s.Frame,
+		Lat:              s.Latitude,
+		Lon:              s.Longitude,
+		Alt:              s.Altitude,
+		Temp:             s.Temp,
+		Humidity:         s.Humidity,
+		VelV:             s.VelV,
+		VelH:             velH,
+		Heading:          s.Heading,
+		Sats:             s.Sats,
+		Batt:             s.Batt,
+		Frequency:        freq,
+		BurstTimer:       s.BurstTimer,
+		Snr:              s.Snr,
+	}
+}
+
+// AutoRXSource is a TelemetrySource that listens for radiosonde_auto_rx UDP broadcasts on the local network
+type AutoRXSource struct {
+	addr string
+	conn *net.UDPConn
+}
+
+// NewAutoRXSource creates an AutoRXSource bound to host:port, it does not listen until Start is called.
+func NewAutoRXSource(host string, port int) *AutoRXSource {
+	return &AutoRXSource{addr: net.JoinHostPort(host, strconv.Itoa(port))}
+}
+
+func (s *AutoRXSource) Name() string {
+	return "autorx"
+}
+
+// Start binds the UDP socket and hands every PAYLOAD_SUMMARY to handler
+func (s *AutoRXSource) Start(handler PacketHandler) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve auto_rx listen address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for auto_rx packets: %w", err)
+	}
+	s.conn = conn
+	fmt.Printf("[*] Listening for auto_rx packets on %s\n", s.addr)
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				// The socket was closed by Stop
+				return
+			}
+			var summary AutoRXPayloadSummary
+			if err := json.Unmarshal(buf[:n], &summary); err != nil {
+				fmt.Println("Error parsing auto_rx packet:", err)
+				continue
+			}
+			// auto_rx also broadcasts other message types (e.g. OZI, LOG), we only want telemetry
+			if summary.Type != "PAYLOAD_SUMMARY" || summary.Callsign == "" {
+				continue
+			}
+			handler([]SHPacket{summary.ToSHPacket(time.Now().UTC())})
+		}
+	}()
+	return nil
+}
+
+func (s *AutoRXSource) Stop() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
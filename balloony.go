@@ -1,34 +1,21 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/dustin/go-humanize"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	dotenv "github.com/joho/godotenv"
 )
 
-// Development hard-coded bypass to the location filtering
-// Warning: This could get messy if ran during normal launch hours
-var bypassLocationFilter = false
-
 // Variables we keep in-memory
-var boundaryPts [][]float64
-var launchSites []Point
 var redisclient *RedisMgr
-var updateInterval int64
-var timezone string = "Etc/UTC"
-var message_usual = "A new sonde has been detected!"
-var message_unusual = "Unusual Sonde Detected!"
 
 var receivers []Point
 var receiversMutex sync.RWMutex
@@ -54,30 +41,35 @@ func startReceiversUpdater() {
 	}()
 }
 
-var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	// Parse the message payload into a SondeHub packet
-	pkts, err := ParseBatch(msg.Payload())
-	if err != nil {
-		fmt.Println("Error parsing packets:", err)
-		return
-	}
-
+// processPackets is the PacketHandler shared by every TelemetrySource
+func processPackets(pkts []SHPacket) {
 	// In most situations, we only get 1 packet, but we still handle it with a foreach in the situation where we have a multi-sdr receiver
 	for _, pkt := range pkts {
-		// TEST: Test the nearest point functionality
-		// closest, dist, err := FindClosestPoint(pkt.Lat, pkt.Lon, launchSites)
-		// if err != nil {
-		// 	fmt.Println("Error finding closest point:", err)
-		// 	return
-		// }
-		// fmt.Printf("Closest launch site to %s is %s at distance %.2f miles\n", pkt.Serial, closest.Name, dist)
-
 		// This is the main processing loop for incoming sondehub packets
-		// Check to see if the sonde is inside of our area of interest
-		if !InsidePoly([]float64{pkt.Lon, pkt.Lat}, boundaryPts) {
-			// Skip packets that are outside the defined boundary
-			if !bypassLocationFilter {
-				return
+		// Check to see which of our areas of interest the sonde is inside of, or predicted to land in
+		cfg := currentConfig()
+		matched := MatchSondeRegions(pkt)
+		if len(matched) == 0 {
+			switch {
+			case cfg.BypassLocationFilter:
+				// Warning: bypass_location_filter could get messy if ran during normal launch hours
+				matched = cfg.Regions
+			case cfg.PredictionTracking.Enabled:
+				// Sondes picked up from their predicted path keep updating while still outside every region,
+				// anything else is watched in case it drifts into one
+				active, err := redisclient.IsActiveSonde(pkt.Serial)
+				if err != nil {
+					fmt.Println("Error checking active sonde:", err)
+					continue
+				}
+				if !active {
+					watchSonde(pkt, clock.Now().UTC().Unix())
+					continue
+				}
+			default:
+				// Skip packets that are outside every defined boundary, active sondes are only marked as heard from
+				touchActiveSonde(pkt)
+				continue
 			}
 		}
 
@@ -90,7 +82,7 @@ var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Me
 		if err != nil {
 			fmt.Println("Error getting SondeSession from Redis:", err)
 			releaseSonde(pkt.Serial)
-			return
+			continue
 		}
 
 		// iMet sonde VelV spoofing
@@ -99,13 +91,7 @@ var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Me
 				fmt.Println("Existing iMetAlt:", session.IMetAlt)
 				// If IMetAlt is set(we use omitempty)
 				if session.IMetAlt != 0 {
-					if pkt.Alt < float64(session.IMetAlt) {
-						// if the altitude has dropped, set the VelV to -1
-						pkt.VelV = -1
-					} else {
-						// If the altitude is higher than the IMetAlt, we set it to 1
-						pkt.VelV = 1
-					}
+					pkt.VelV = iMetVelV(session.IMetAlt, pkt.Alt)
 				}
 				// set the IMetAlt to the current altitude
 				session.IMetAlt = int(pkt.Alt)
@@ -113,9 +99,9 @@ var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Me
 		}
 
 		if session == nil {
-			handleNewSonde(pkt)
+			handleNewSonde(pkt, matched)
 		} else {
-			handleSonde(pkt, session)
+			handleSonde(pkt, session, matched)
 		}
 
 		releaseSonde(pkt.Serial)
@@ -123,52 +109,197 @@ var messagePubHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Me
 
 }
 
-func handleSonde(pkt SHPacket, session *SondeSession) {
-	// Originally we used packet times but I have found that some stations and TTGO receivers do not provide accurate timestamps.
-	now := time.Now().UTC().Unix()
+// dueForUpdate returns true if enough time has passed since the region's message was last updated
+func dueForUpdate(pkt SHPacket, lastUpdate, updateInterval, now int64) bool {
 	// Check to see if the session time has been long enough
-	if now < session.Time+updateInterval {
+	if now < lastUpdate+updateInterval {
 		// Conditionally, if the sonde is descending and less than 10kft,
 		// our update interval changes to 30 seconds
-		if pkt.Alt < 3048 && pkt.VelV < 0 { // 10,000 feet in meters
-			if now < session.Time+30 {
+		if pkt.Alt < lowAltitudeMeters && pkt.VelV < 0 {
+			if now < lastUpdate+30 {
 				// If the packet is less than 30 seconds old, we don't update
-				return
+				return false
 			}
 		} else {
 			// High Altitude + not passed interval
+			return false
+		}
+	}
+	return true
+}
+
+func handleSonde(pkt SHPacket, session *SondeSession, matched []*Region) {
+	// Originally we used packet times but I have found that some stations and TTGO receivers do not provide accurate timestamps.
+	now := clock.Now().UTC().Unix()
+
+	// The phase tracker sees every packet, and the session is saved whether or not we update Discord
+	prevPhase := session.Phase
+	wasTerminal := prevPhase.Terminal()
+	phaseChanged := session.UpdatePhase(pkt, now)
+	recordHistory(pkt, session, now)
+	defer func() {
+		err := redisclient.SaveSondeSession(pkt.Serial, session)
+		if err != nil {
+			fmt.Println("Error saving SondeSession to Redis:", err)
+		}
+	}()
+
+	// A sonde drifting into another region gets its own message there
+	var newRegions []*Region
+	for _, region := range matched {
+		if _, ok := session.Regions[region.Name]; !ok {
+			newRegions = append(newRegions, region)
+		}
+	}
+	if len(newRegions) > 0 {
+		loc, err := ReverseGeocode(pkt.Lat, pkt.Lon)
+		if err != nil {
+			fmt.Println("Error reverse geocoding:", err)
+		}
+		for _, region := range newRegions {
+			postNewSondeMessage(pkt, session, region, loc, now)
+		}
+	}
+
+	if phaseChanged {
+		fmt.Printf("%s phase changed to %s\n", pkt.Serial, session.Phase)
+		if wasTerminal && !session.Phase.Terminal() {
+			redisclient.TrackActiveSonde(pkt.Serial)
+		} else if session.Phase.Terminal() {
+			redisclient.UntrackActiveSonde(pkt.Serial)
+		}
+		switch session.Phase {
+		case PhaseBurst:
+			announceBurst(pkt, session)
+		case PhaseLanded:
+			// The landing summary replaces the regular update
+			sendLandingSummary(pkt.Serial, session)
 			return
 		}
 	}
 
-	// Pull Geo APIs for reverse geocoding
-	actLoc, err := RadarReverseGeocode(pkt.Lat, pkt.Lon)
+	// Landed sondes keep transmitting from the ground, the summary stays as it is
+	if session.Phase == PhaseLanded {
+		return
+	}
+
+	// Phase changes are always shown right away, everything else waits for each region's update interval.
+	// Descent follows burst on the very next packet, it waits for the next update after the burst one.
+	forceUpdate := phaseChanged && !(prevPhase == PhaseBurst && session.Phase == PhaseDescent)
+	var due []string
+	for name, msg := range session.Regions {
+		region := regionByName(name)
+		if region == nil {
+			// Region was removed from the configuration
+			continue
+		}
+		if forceUpdate || dueForUpdate(pkt, msg.Time, region.UpdateInterval, now) {
+			due = append(due, name)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	// Pull Geo APIs for reverse geocoding, the update still goes out without a place name
+	actLoc, err := ReverseGeocode(pkt.Lat, pkt.Lon)
 	if err != nil {
 		fmt.Println("Error reverse geocoding:", err)
-		return
 	}
 
+	// Our own prediction is shown next to SondeHub's, and stands in for it when SondeHub has none
+	history, lerr := LoadHistory(pkt.Serial)
+	track := historyTrack(history)
+	var localPred *SHPredictionResult
+	if lerr == nil {
+		localPred, lerr = LocalPrediction(pkt, session, track)
+	}
 	shPred, err := GetPrediction(pkt.Serial)
 	if err != nil {
 		fmt.Println("Error getting prediction:", err)
+		if lerr != nil {
+			fmt.Println("Error getting local prediction:", lerr)
+			return
+		}
+		shPred, localPred = localPred, nil
+	} else {
+		predictions.Set(pkt.Serial, shPred)
+		// Keep the predicted burst altitude from before the burst to compare against the real one
+		if session.Phase == PhaseLaunch || session.Phase == PhaseAscent {
+			session.PredBurstAlt = shPred.BurstAltitude
+		}
+	}
+	// SondeHub may call the landing before our own tracker does
+	if shPred.Landed == 1 && session.Phase == PhaseDescent {
+		session.setPhase(PhaseLanded, now)
+		redisclient.UntrackActiveSonde(pkt.Serial)
+		fmt.Printf("%s phase changed to %s (SondeHub prediction)\n", pkt.Serial, session.Phase)
+		sendLandingSummary(pkt.Serial, session)
 		return
 	}
 
-	// Render the map image to memory for Discord upload
-	hasImage := false
-	buf, err := RenderSondeMapToBuffer(pkt, shPred)
-	if err != nil {
-		fmt.Println("Error rendering map image:", err)
-	} else {
-		hasImage = true
+	// Each region's map profile is rendered to memory for Discord upload, once per profile
+	rendered := make(map[*MapProfile]*bytes.Buffer)
+	for _, name := range due {
+		profile := regionMapProfile(name)
+		if _, ok := rendered[profile]; ok {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := RenderSondeMap(buf, profile, pkt, shPred, session, track); err != nil {
+			fmt.Println("Error rendering map image:", err)
+			buf = nil
+		}
+		rendered[profile] = buf
 	}
 
-	predLoc, err := RadarReverseGeocode(shPred.Latitude, shPred.Longitude)
+	// The telemetry charts go in an embed below the map
+	var charts *bytes.Buffer
+	if currentConfig().Map.Charts && len(history) > 1 {
+		charts, err = RenderTelemetryCharts(session, history)
+		if err != nil {
+			fmt.Println("Error rendering telemetry charts:", err)
+		}
+	}
+
+	predLoc, err := ReverseGeocode(shPred.Latitude, shPred.Longitude)
 	if err != nil {
 		fmt.Println("Error reverse geocoding prediction:", err)
-		return
 	}
 
+	notifyChaseTeam(pkt, session, shPred, predLoc)
+
+	for _, name := range due {
+		msg := session.Regions[name]
+		embed := buildUpdateEmbed(pkt, session, shPred, localPred, actLoc, predLoc, regionLocation(name))
+
+		if buf := rendered[regionMapProfile(name)]; buf != nil {
+			_, derr := SendUpdatedWebhookWithImage(msg.Webhook, &embed, buf, charts)
+			if derr != nil {
+				fmt.Printf("Error sending Discord message to %s: %v\n", name, derr)
+				continue
+			}
+		} else {
+			// Since we are updating an existing message, we don't need to send a content field
+			message := DiscordMessage{
+				Embeds: []DiscordEmbed{embed},
+			}
+
+			_, derr := SendDiscordWebhook(message, msg.Webhook, true)
+			if derr != nil {
+				fmt.Printf("Error sending Discord message to %s: %v\n", name, derr)
+				continue
+			}
+		}
+
+		// Update the time in the session
+		msg.Time = pkt.TimeReceived.Unix()
+	}
+}
+
+// buildUpdateEmbed builds the regular in-flight update, times are shown in loc
+// localPred is shown next to shPred when both exist, it may be nil
+func buildUpdateEmbed(pkt SHPacket, session *SondeSession, shPred, localPred *SHPredictionResult, actLoc, predLoc Place, loc *time.Location) DiscordEmbed {
 	// Build the message to send to Discord
 	var fields []DiscordField
 	fields = append(fields, DiscordField{
@@ -191,21 +322,26 @@ func handleSonde(pkt SHPacket, session *SondeSession) {
 	})
 
 	fields = append(fields, DiscordField{
-		Name:  fmt.Sprintf("Over %s", GetLocationFromRadarResponse(actLoc)),
+		Name:  fmt.Sprintf("Over %s", actLoc),
 		Value: zeroWidthSpace,
 	})
 
-	loc, err := time.LoadLocation(timezone)
-	if err != nil {
-		fmt.Println("Error loading timezone:", err)
-		loc = time.UTC
-	}
-
 	localPredTime := shPred.Time.In(loc)
-	fields = append(fields, DiscordField{
-		Name:  fmt.Sprintf("Predicted to land in %s around %s", GetLocationFromRadarResponse(predLoc), localPredTime.Format("3:04 PM")),
+	predField := DiscordField{
+		Name:  fmt.Sprintf("Predicted to land in %s around %s", predLoc, localPredTime.Format("3:04 PM")),
 		Value: zeroWidthSpace,
-	})
+	}
+	if shPred.Local {
+		predField.Value = "Local estimate, SondeHub has no prediction"
+	}
+	fields = append(fields, predField)
+	if localPred != nil {
+		fields = append(fields, DiscordField{
+			Name: fmt.Sprintf("Local estimate: %.1f mi from SondeHub's, around %s",
+				haversineMiles(shPred.Latitude, shPred.Longitude, localPred.Latitude, localPred.Longitude), localPred.Time.In(loc).Format("3:04 PM")),
+			Value: zeroWidthSpace,
+		})
+	}
 
 	// Check to see if anybody is nearby (20 miles)
 	receiversMutex.RLock()
@@ -223,12 +359,10 @@ func handleSonde(pkt SHPacket, session *SondeSession) {
 				Value: zeroWidthSpace,
 			})
 		}
-		// else {
-		// 	fields = append(fields, DiscordField{
-		// 		Name:  fmt.Sprintf("Closest receiver: %s at %.2f miles (too far away)", point.Name, dist),
-		// 		Value: zeroWidthSpace,
-		// 	})
-		// }
+	}
+
+	if field, ok := drivingField("Drive to predicted landing", shPred.Latitude, shPred.Longitude); ok {
+		fields = append(fields, field)
 	}
 
 	// If RS41, add the RS41 date of manufacture
@@ -244,71 +378,75 @@ func handleSonde(pkt SHPacket, session *SondeSession) {
 		}
 	}
 
-	embedTitle := fmt.Sprintf("%s %s is airborne", defaultString(pkt.Subtype, pkt.Type), pkt.Serial)
+	embedTitle := session.Phase.EmbedTitle(defaultString(pkt.Subtype, pkt.Type), pkt.Serial)
 
-	embed := DiscordEmbed{
+	return DiscordEmbed{
 		Type:        "rich",
 		Title:       embedTitle,
 		Description: "",
-		Color:       0x00FFFF,
+		Color:       session.Phase.Style().Color,
 		Url:         fmt.Sprintf("https://sondehub.org/%s", pkt.Serial),
 		Fields:      fields,
 	}
-
-	if hasImage {
-		SendUpdatedWebhookWithImage(session.Webhook, &embed, buf)
-	} else {
-		// Since we are updating an existing message, we don't need to send a content field
-		message := DiscordMessage{
-			Embeds: []DiscordEmbed{embed},
-		}
-
-		_, derr := SendDiscordWebhook(message, session.Webhook, true)
-		if derr != nil {
-			fmt.Println("Error sending Discord message:", derr)
-			return
-		}
-	}
-
-	// Update the time in the session
-	session.Time = pkt.TimeReceived.Unix()
-
-	err = redisclient.SaveSondeSession(pkt.Serial, session)
-	if err != nil {
-		fmt.Println("Error saving SondeSession to Redis:", err)
-		return
-	}
 }
 
-func handleNewSonde(pkt SHPacket) {
+func handleNewSonde(pkt SHPacket, matched []*Region) {
 	// Fix for receivers with inaccurate time
-	now := time.Now().UTC()
+	now := clock.Now().UTC()
 	nowu := now.Unix()
 	// This function handles new sondes that are detected
 	fmt.Printf("New sonde detected: %s at %s\n", pkt.Serial, now) // placeholder
 	session := &SondeSession{
-		Time:     nowu,
-		Webhook:  os.Getenv("DISCORD_WEBHOOK_URL"),
-		FromText: "",
+		Regions:   make(map[string]*RegionMessage),
+		FromText:  "",
+		SondeType: defaultString(pkt.Subtype, pkt.Type),
 	}
+	session.UpdatePhase(pkt, nowu)
+	recordHistory(pkt, session, nowu)
 
 	// Attempt to find out where the sonde was launched from
-	closest, dist, err := FindClosestPoint(pkt.Lat, pkt.Lon, launchSites)
+	session.FirstSeen = nowu
+	session.LaunchLat = pkt.Lat
+	session.LaunchLon = pkt.Lon
+	closest, dist, err := FindClosestPoint(pkt.Lat, pkt.Lon, currentConfig().launchSites)
 	if err != nil {
 		fmt.Println("Error finding closest launch site:", err)
 		session.FromText = ""
 	}
-	if dist < 10 { // If the closest launch site is within 10 miles
+	if err == nil && dist < 10 { // If the closest launch site is within 10 miles
 		session.FromText = fmt.Sprintf("From %s", closest.Name)
+		session.LaunchLat = closest.Lat
+		session.LaunchLon = closest.Lon
 	}
 
 	// Then get the sonde's reverse geocode location
-	loc, err := RadarReverseGeocode(pkt.Lat, pkt.Lon)
+	loc, err := ReverseGeocode(pkt.Lat, pkt.Lon)
 	if err != nil {
 		fmt.Println("Error reverse geocoding:", err)
 	}
 
-	// Then build a message to send to Discord
+	for _, region := range matched {
+		postNewSondeMessage(pkt, session, region, loc, nowu)
+	}
+	if len(session.Regions) == 0 {
+		// Nothing was posted, try again with the next packet
+		return
+	}
+
+	// Save the session to Redis
+	err = redisclient.SaveSondeSession(pkt.Serial, session)
+	if err != nil {
+		fmt.Println("Error saving SondeSession to Redis:", err)
+		return
+	}
+	if err := redisclient.TrackActiveSonde(pkt.Serial); err != nil {
+		fmt.Println("Error tracking active sonde:", err)
+	}
+}
+
+// postNewSondeMessage posts the "new sonde" alert to a region and records the message in the session
+func postNewSondeMessage(pkt SHPacket, session *SondeSession, region *Region, loc Place, now int64) {
+	// Build a message to send to Discord
 	var fields []DiscordField
 
 	fields = append(fields, DiscordField{
@@ -316,8 +454,13 @@ func handleNewSonde(pkt SHPacket) {
 		Value: zeroWidthSpace,
 	})
 
+	// Sondes that drift in from another region (or are only predicted to) were launched somewhere else
+	locationLabel := "Launched from"
+	if session.Phase != PhaseLaunch || !region.Contains(pkt.Lat, pkt.Lon) {
+		locationLabel = "Over"
+	}
 	fields = append(fields, DiscordField{
-		Name:  fmt.Sprintf("Launched from %s", GetLocationFromRadarResponse(loc)),
+		Name:  fmt.Sprintf("%s %s", locationLabel, loc),
 		Value: zeroWidthSpace,
 	})
 
@@ -332,132 +475,160 @@ func handleNewSonde(pkt SHPacket) {
 		Value: zeroWidthSpace,
 	})
 
+	// Matched on the prediction rather than where it is now, so it is drifting into the region
+	drifting := false
+	if pred := predictions.Get(pkt.Serial); pred != nil && !region.Contains(pkt.Lat, pkt.Lon) {
+		if region.Contains(pred.Latitude, pred.Longitude) {
+			drifting = true
+			fields = append(fields, DiscordField{
+				Name:  "Predicted to land inside this alert zone",
+				Value: zeroWidthSpace,
+			})
+		} else if enters, ok := pred.EntersRegion(region); ok {
+			drifting = true
+			fields = append(fields, DiscordField{
+				Name:  fmt.Sprintf("Predicted to enter this alert zone around %s", enters.In(region.Location()).Format("3:04 PM")),
+				Value: zeroWidthSpace,
+			})
+		}
+	}
+
 	fields = append(fields, DiscordField{
-		Name:  fmt.Sprintf("Prediction available in <t:%d:R>", nowu+updateInterval),
+		Name:  fmt.Sprintf("Prediction available in <t:%d:R>", now+region.UpdateInterval),
 		Value: zeroWidthSpace,
 	})
 
 	// Generate the strings that are conditional
-	usualTime := IsUsualTime(now)
-	var messageContent *string
-	embedTitle := fmt.Sprintf("%s %s is airborne %s", defaultString(pkt.Subtype, pkt.Type), pkt.Serial, session.FromText)
-	if usualTime {
-		messageContent = &message_usual
-	} else {
-		messageContent = &message_unusual
+	usualTime := IsUsualTime(time.Unix(now, 0))
+	var messageContent string
+	embedTitle := fmt.Sprintf("%s %s", session.Phase.EmbedTitle(session.SondeType, pkt.Serial), session.FromText)
+	switch {
+	case drifting:
+		messageContent = region.MessageDrift
+	case usualTime:
+		messageContent = region.MessageUsual
+	default:
+		messageContent = region.MessageUnusual
 	}
 
 	embed := DiscordEmbed{
 		Type:        "rich",
 		Title:       embedTitle,
 		Description: "",
-		Color:       0x00FFFF,
+		Color:       session.Phase.Style().Color,
 		Url:         fmt.Sprintf("https://sondehub.org/%s", pkt.Serial),
 		Fields:      fields,
 	}
 
 	message := DiscordMessage{
-		Content: *messageContent,
+		Content: messageContent,
 		Embeds:  []DiscordEmbed{embed},
 	}
 
 	// Send the message to Discord
-	res, err := SendDiscordWebhook(message, session.Webhook, false)
+	res, err := SendDiscordWebhook(message, region.Webhook, false)
 	if err != nil {
-		fmt.Println("Error sending Discord message:", err)
+		fmt.Printf("Error sending Discord message to %s: %v\n", region.Name, err)
 		return
 	}
 
-	// Update the webhook URL in the session
-	session.Webhook = fmt.Sprintf("%s/messages/%s", session.Webhook, res.ID)
-	// Save the session to Redis
-	err = redisclient.SaveSondeSession(pkt.Serial, session)
-	if err != nil {
-		fmt.Println("Error saving SondeSession to Redis:", err)
-		return
+	// Keep the message URL in the session so we can edit it later
+	if session.Regions == nil {
+		session.Regions = make(map[string]*RegionMessage)
+	}
+	session.Regions[region.Name] = &RegionMessage{
+		Webhook: fmt.Sprintf("%s/messages/%s", region.Webhook, res.ID),
+		Time:    now,
 	}
 }
 
 func main() {
-	// Check for required environment variables
-	err := dotenv.Load()
-	requiredVars := []string{"RADAR_API_KEY", "ALERT_BOUNDS", "DISCORD_WEBHOOK_URL", "UPDATE_INTERVAL"}
-	for _, v := range requiredVars {
-		if os.Getenv(v) == "" {
-			log.Fatalf("Required environment variable %s is not set", v)
-			panic(fmt.Sprintf("Required environment variable %s is not set", v))
-		}
-	}
-
-	// Load the boundary points
-	bounds := os.Getenv("ALERT_BOUNDS")
-	if err := json.Unmarshal([]byte(bounds), &boundaryPts); err != nil {
-		log.Fatalf("Error parsing ALERT_BOUNDS: %v", err)
-		panic(fmt.Sprintf("Error parsing ALERT_BOUNDS: %v", err))
-	}
-
-	// If we have a set timezone, use it
-	if tz := os.Getenv("TIMEZONE"); tz != "" {
-		timezone = tz
-	}
+	// .env files are still supported, and override the configuration file
+	dotenv.Load()
 
-	// Check to see if we have custom messages defined
-	if msg := os.Getenv("MESSAGE_USUAL"); msg != "" {
-		message_usual = msg
+	// Validating the configuration must work without anything else being reachable
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
 	}
 
-	if msg := os.Getenv("MESSAGE_UNUSUAL"); msg != "" {
-		message_unusual = msg
-	}
-
-	// Load the update interval
-	updateIntervalStr := os.Getenv("UPDATE_INTERVAL")
-	updateInterval, err = strconv.ParseInt(updateIntervalStr, 10, 64)
-	if err != nil {
-		log.Fatalf("Error parsing UPDATE_INTERVAL: %v", err)
-		panic(fmt.Sprintf("Error parsing UPDATE_INTERVAL: %v", err))
-	}
+	loadStartupConfig()
+	cfg := currentConfig()
 
-	// Load the launch sites from launchsites.json (should be in the same directory)
-	launchSites, err = ParseLaunchSitesJSON("launchsites.json")
+	redisclient = NewRedisClient(cfg.Redis)
+	err := redisclient.Ping()
 	if err != nil {
-		log.Fatalf("Error loading launch sites: %v", err)
-		panic(fmt.Sprintf("Error loading launch sites: %v", err))
+		fmt.Println("Error connecting to Redis:", err)
+		panic(err)
 	}
 
-	// Check for bypassLocationFilter environment variable
-	if bypassEnv := os.Getenv("BYPASS_LOCATION_FILTER"); bypassEnv != "" {
-		if bypassEnv == "true" || bypassEnv == "1" {
-			bypassLocationFilter = true
-			fmt.Println("Bypass location filter is enabled. All sondes will be processed regardless of location.")
-		} else {
-			bypassLocationFilter = false
+	// Subcommands share the configuration and Redis connection with the bot itself
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			startReceiversUpdater()
+			if err := runReplay(os.Args[2:]); err != nil {
+				log.Fatalf("Error replaying recording: %v", err)
+			}
+		case "geocode":
+			if err := runGeocodeCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error geocoding: %v", err)
+			}
+		case "export":
+			if err := runExportCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error exporting flight: %v", err)
+			}
+		case "render":
+			if err := runRenderCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error rendering map: %v", err)
+			}
+		case "chase":
+			if err := runChaseCommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error managing chase team: %v", err)
+			}
+		default:
+			log.Fatalf("Unknown command %s", os.Args[1])
 		}
+		return
 	}
 
-	// Connect to sondehub MQTT broker
-	var broker = "ws-reader.v2.sondehub.org"
-	var port = 443
-
-	mqttclient := MQTTConnection(broker, port, "balloonyv2", messagePubHandler)
-	if token := mqttclient.Connect(); token.Wait() && token.Error() != nil {
-		fmt.Println("Error connecting to SondeHub", token.Error())
-		panic(token.Error())
+	// Optionally record every raw MQTT batch so flights can be replayed later
+	if cfg.RecordFile != "" {
+		recorder, err = NewRecorder(cfg.RecordFile)
+		if err != nil {
+			log.Fatalf("Error opening record_file: %v", err)
+		}
+		defer recorder.Close()
+		fmt.Println("Recording MQTT batches to", cfg.RecordFile)
 	}
 
-	redisclient = NewRedisClient()
-	err = redisclient.Ping()
+	// Connect to the telemetry sources (SondeHub MQTT, local auto_rx stations, ...)
+	sources, err := NewTelemetrySources(cfg)
 	if err != nil {
-		fmt.Println("Error connecting to Redis:", err)
-		panic(err)
+		log.Fatalf("Error configuring telemetry sources: %v", err)
+	}
+	for _, source := range sources {
+		if err := source.Start(processPackets); err != nil {
+			fmt.Printf("Error connecting to %s: %v\n", source.Name(), err)
+			panic(err)
+		}
+		defer source.Stop()
 	}
 
-	// Start the receivers updater goroutine
+	// Start the receivers updater, prediction updater/watcher and lost signal sweeper goroutines
 	startReceiversUpdater()
+	startPredictionUpdater()
+	startPredictionWatcher()
+	startPhaseSweeper()
 
-	// Wait for Ctrl+C (SIGINT) to exit
+	// Wait for Ctrl+C (SIGINT) to exit, reloading the configuration on SIGHUP
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range c {
+		if sig == syscall.SIGHUP {
+			reloadConfig()
+			continue
+		}
+		break
+	}
 	fmt.Println("\nExiting...")
 }
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Polygon is a list of rings of [lon, lat] pairs. The first ring is the outer boundary, any others are holes.
+type Polygon [][][]float64
+
+// Geometry is an alert area made of one or more polygons (a GeoJSON MultiPolygon)
+type Geometry []Polygon
+
+// NewGeometry builds a Geometry from polygons, unwrapping any ring that crosses the antimeridian
+func NewGeometry(polys ...Polygon) Geometry {
+	g := make(Geometry, 0, len(polys))
+	for _, poly := range polys {
+		unwrapped := make(Polygon, len(poly))
+		for i, ring := range poly {
+			unwrapped[i] = unwrapRing(ring)
+		}
+		g = append(g, unwrapped)
+	}
+	return g
+}
+
+// unwrapRing makes longitudes continuous, so an edge from 179 to -179 becomes 179 to 181 instead of
+// crossing the whole map. The ring may then extend past ±180, which Contains accounts for.
+func unwrapRing(ring [][]float64) [][]float64 {
+	out := make([][]float64, len(ring))
+	offset := 0.0
+	for i, pt := range ring {
+		lon := pt[0] + offset
+		if i > 0 {
+			prev := out[i-1][0]
+			for lon-prev > 180 {
+				lon -= 360
+				offset -= 360
+			}
+			for prev-lon > 180 {
+				lon += 360
+				offset += 360
+			}
+		}
+		out[i] = []float64{lon, pt[1]}
+	}
+	return out
+}
+
+// Contains returns true if the point is inside any polygon's outer ring and outside all of its holes
+func (g Geometry) Contains(lat, lon float64) bool {
+	for _, poly := range g {
+		if len(poly) == 0 || !ringContains(poly[0], lat, lon) {
+			continue
+		}
+		inHole := false
+		for _, hole := range poly[1:] {
+			if ringContains(hole, lat, lon) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// DistanceMiles is how far the point is from the closest edge of the geometry, 0 if it is inside
+func (g Geometry) DistanceMiles(lat, lon float64) float64 {
+	if g.Contains(lat, lon) {
+		return 0
+	}
+	closest := math.Inf(1)
+	for _, poly := range g {
+		for _, ring := range poly {
+			// Close the ring, so the last edge is measured too
+			closed := append(ring[:len(ring):len(ring)], ring[0])
+			closest = math.Min(closest, pathDistanceMiles(lat, lon, closed))
+		}
+	}
+	return closest
+}
+
+// ringContains tests the point and its copies one world to either side, for rings unwrapped past ±180
+func ringContains(ring [][]float64, lat, lon float64) bool {
+	for _, shift := range []float64{0, 360, -360} {
+		if InsidePoly([]float64{lon + shift, lat}, ring) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns a problem with the geometry, or nil if it is usable
+func (g Geometry) validate() error {
+	if len(g) == 0 {
+		return errors.New("no polygons found")
+	}
+	for i, poly := range g {
+		if len(poly) == 0 {
+			return fmt.Errorf("polygon %d has no rings", i+1)
+		}
+		for j, ring := range poly {
+			if len(ring) < 3 {
+				return fmt.Errorf("polygon %d ring %d needs at least 3 points", i+1, j+1)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadBoundaryFile reads an alert area from a GeoJSON (.geojson, .json), KML (.kml) or KMZ (.kmz) file
+func LoadBoundaryFile(filename string) (Geometry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var g Geometry
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".geojson", ".json":
+		g, err = ParseGeoJSON(data)
+	case ".kml":
+		g, err = ParseKML(bytes.NewReader(data))
+	case ".kmz":
+		g, err = parseKMZ(data)
+	default:
+		return nil, fmt.Errorf("unsupported boundary file type %s, expected .geojson, .json, .kml or .kmz", filepath.Ext(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// geoJSONObject covers every GeoJSON object type we read polygons from
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Features    []geoJSONObject `json:"features"`
+	Geometries  []geoJSONObject `json:"geometries"`
+	Properties  map[string]any  `json:"properties"`
+}
+
+// GeoJSONFeature is one feature's polygons and properties, e.g. a county and its name
+type GeoJSONFeature struct {
+	Properties map[string]any
+	Geometry   Geometry
+}
+
+// ParseGeoJSON collects every Polygon and MultiPolygon in a GeoJSON geometry, Feature or FeatureCollection.
+// Other geometry types (points, lines) are ignored.
+func ParseGeoJSON(data []byte) (Geometry, error) {
+	var obj geoJSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	var polys []Polygon
+	if err := obj.collect(&polys); err != nil {
+		return nil, err
+	}
+	return NewGeometry(polys...), nil
+}
+
+// ParseGeoJSONFeatures returns the polygons of every feature separately, along with their properties.
+// Features without polygons are skipped.
+func ParseGeoJSONFeatures(data []byte) ([]GeoJSONFeature, error) {
+	var obj geoJSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	features := obj.Features
+	if obj.Type == "Feature" {
+		features = []geoJSONObject{obj}
+	}
+	var out []GeoJSONFeature
+	for i := range features {
+		var polys []Polygon
+		if err := features[i].collect(&polys); err != nil {
+			return nil, err
+		}
+		if len(polys) > 0 {
+			out = append(out, GeoJSONFeature{Properties: features[i].Properties, Geometry: NewGeometry(polys...)})
+		}
+	}
+	return out, nil
+}
+
+func (o *geoJSONObject) collect(polys *[]Polygon) error {
+	switch o.Type {
+	case "FeatureCollection":
+		for i := range o.Features {
+			if err := o.Features[i].collect(polys); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if o.Geometry != nil {
+			return o.Geometry.collect(polys)
+		}
+	case "GeometryCollection":
+		for i := range o.Geometries {
+			if err := o.Geometries[i].collect(polys); err != nil {
+				return err
+			}
+		}
+	case "Polygon":
+		var poly Polygon
+		if err := json.Unmarshal(o.Coordinates, &poly); err != nil {
+			return fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		if err := trimPolygon(poly); err != nil {
+			return fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		*polys = append(*polys, poly)
+	case "MultiPolygon":
+		var multi []Polygon
+		if err := json.Unmarshal(o.Coordinates, &multi); err != nil {
+			return fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+		for _, poly := range multi {
+			if err := trimPolygon(poly); err != nil {
+				return fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+			}
+			*polys = append(*polys, poly)
+		}
+	}
+	return nil
+}
+
+// trimPolygon drops altitudes, GeoJSON positions may be [lon, lat, alt], and rejects positions
+// without a longitude and latitude
+func trimPolygon(poly Polygon) error {
+	for _, ring := range poly {
+		for i, pt := range ring {
+			if len(pt) < 2 {
+				return fmt.Errorf("position %v needs a longitude and latitude", pt)
+			}
+			ring[i] = pt[:2]
+		}
+	}
+	return nil
+}
+
+// ParseKML collects every Polygon in a KML document, including those inside MultiGeometry
+func ParseKML(r io.Reader) (Geometry, error) {
+	dec := xml.NewDecoder(r)
+	var polys []Polygon
+	var current Polygon
+	inPolygon, inOuter, inInner, inCoords := false, false, false, false
+	var coords strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Polygon":
+				inPolygon = true
+				current = Polygon{nil}
+			case "outerBoundaryIs":
+				inOuter = true
+			case "innerBoundaryIs":
+				inInner = true
+			case "coordinates":
+				inCoords = true
+				coords.Reset()
+			}
+		case xml.CharData:
+			if inCoords {
+				coords.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "Polygon":
+				if len(current[0]) > 0 {
+					polys = append(polys, current)
+				}
+				inPolygon = false
+			case "outerBoundaryIs":
+				inOuter = false
+			case "innerBoundaryIs":
+				inInner = false
+			case "coordinates":
+				inCoords = false
+				if !inPolygon {
+					continue
+				}
+				ring, err := parseKMLCoordinates(coords.String())
+				if err != nil {
+					return nil, err
+				}
+				if inOuter {
+					current[0] = ring
+				} else if inInner {
+					current = append(current, ring)
+				}
+			}
+		}
+	}
+	return NewGeometry(polys...), nil
+}
+
+// parseKMLCoordinates parses a KML coordinate list: whitespace separated lon,lat[,alt] tuples
+func parseKMLCoordinates(s string) ([][]float64, error) {
+	var ring [][]float64
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		ring = append(ring, []float64{lon, lat})
+	}
+	return ring, nil
+}
+
+// parseKMZ reads the first .kml document in a KMZ archive
+func parseKMZ(data []byte) (Geometry, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if !strings.EqualFold(filepath.Ext(f.Name), ".kml") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ParseKML(rc)
+	}
+	return nil, errors.New("no .kml document found in KMZ archive")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// containsCase is a lat/lon pair to test against a geometry, and whether it should be inside
+type containsCase struct {
+	name     string
+	lat, lon float64
+	want     bool
+}
+
+func checkContains(t *testing.T, g Geometry, points []containsCase) {
+	t.Helper()
+	for _, p := range points {
+		if got := g.Contains(p.lat, p.lon); got != p.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", p.name, p.lat, p.lon, got, p.want)
+		}
+	}
+}
+
+func TestGeoJSONPolygonWithHole(t *testing.T) {
+	g, err := ParseGeoJSON([]byte(`{"type": "Polygon", "coordinates": [
+		[[-100, 30], [-90, 30], [-90, 40], [-100, 40], [-100, 30]],
+		[[-97, 33], [-93, 33], [-93, 37], [-97, 37], [-97, 33]]
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, g, []containsCase{
+		{"between the outer ring and the hole", 31, -99, true},
+		{"inside the hole", 35, -95, false},
+		{"outside the outer ring", 45, -95, false},
+	})
+}
+
+func TestGeoJSONMultiPolygon(t *testing.T) {
+	g, err := ParseGeoJSON([]byte(`{"type": "Feature", "geometry": {"type": "MultiPolygon", "coordinates": [
+		[[[-100, 30, 250], [-98, 30, 250], [-98, 32, 250], [-100, 32, 250], [-100, 30, 250]]],
+		[[[-90, 40], [-88, 40], [-88, 42], [-90, 42], [-90, 40]]]
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g) != 2 {
+		t.Fatalf("got %d polygons, want 2", len(g))
+	}
+	checkContains(t, g, []containsCase{
+		{"first polygon", 31, -99, true},
+		{"second polygon", 41, -89, true},
+		{"between the polygons", 36, -94, false},
+	})
+}
+
+func TestGeoJSONRejectsShortPositions(t *testing.T) {
+	_, err := ParseGeoJSON([]byte(`{"type": "Polygon", "coordinates": [[[-100, 30], [-90], [-90, 40]]]}`))
+	if err == nil {
+		t.Error("ParseGeoJSON() accepted a position without a latitude")
+	}
+}
+
+func TestGeometryAcrossAntimeridian(t *testing.T) {
+	// A box from 170°E to 170°W, around Fiji
+	g := NewGeometry(Polygon{{{170, -20}, {-170, -20}, {-170, -10}, {170, -10}, {170, -20}}})
+	checkContains(t, g, []containsCase{
+		{"east of 180", -15, 175, true},
+		{"west of 180", -15, -175, true},
+		{"on the antimeridian", -15, 180, true},
+		{"outside to the east", -15, 165, false},
+		{"outside to the west", -15, -165, false},
+		{"the other side of the world", -15, 0, false},
+	})
+}
+
+func TestParseKML(t *testing.T) {
+	g, err := ParseKML(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Placemark><MultiGeometry>
+  <Polygon>
+    <outerBoundaryIs><LinearRing><coordinates>
+      -100,30,0 -90,30,0 -90,40,0 -100,40,0 -100,30,0
+    </coordinates></LinearRing></outerBoundaryIs>
+    <innerBoundaryIs><LinearRing><coordinates>
+      -97,33 -93,33 -93,37 -97,37 -97,33
+    </coordinates></LinearRing></innerBoundaryIs>
+  </Polygon>
+  <Polygon>
+    <outerBoundaryIs><LinearRing><coordinates>
+      -80,30 -78,30 -78,32 -80,32 -80,30
+    </coordinates></LinearRing></outerBoundaryIs>
+  </Polygon>
+</MultiGeometry></Placemark></Document></kml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g) != 2 {
+		t.Fatalf("got %d polygons, want 2", len(g))
+	}
+	checkContains(t, g, []containsCase{
+		{"first polygon", 31, -99, true},
+		{"inside the hole", 35, -95, false},
+		{"second polygon", 31, -79, true},
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// announceBurst posts a separate burst message to every region following the sonde.
+// The burst point is the highest point seen in the session, not the packet that confirmed the burst.
+func announceBurst(pkt SHPacket, session *SondeSession) {
+	burstLoc, err := ReverseGeocode(session.MaxAltLat, session.MaxAltLon)
+	if err != nil {
+		fmt.Println("Error reverse geocoding burst:", err)
+	}
+
+	// The ascent is a full sounding of the atmosphere, worth a Skew-T diagram
+	var files []DiscordFile
+	if currentConfig().Map.Sounding {
+		history, herr := LoadHistory(pkt.Serial)
+		if herr == nil {
+			var buf *bytes.Buffer
+			buf, herr = RenderSkewT(pkt.Serial, session, history)
+			if herr == nil {
+				files = append(files, DiscordFile{Name: fmt.Sprintf("sounding_%s.png", pkt.Serial), Description: "Skew-T diagram", Data: buf.Bytes()})
+			}
+		}
+		if herr != nil {
+			fmt.Println("Error rendering sounding:", herr)
+		}
+	}
+
+	for name, msg := range session.Regions {
+		embed := buildBurstEmbed(pkt.Serial, session, burstLoc, err == nil, regionLocation(name))
+		var serr error
+		if len(files) > 0 {
+			embed.Image = &EmbedImage{URL: "attachment://" + files[0].Name}
+			_, serr = SendDiscordWebhookWithFiles(DiscordMessage{Embeds: []DiscordEmbed{embed}}, webhookBaseURL(msg.Webhook), false, files)
+		} else {
+			_, serr = SendDiscordWebhook(DiscordMessage{Embeds: []DiscordEmbed{embed}}, webhookBaseURL(msg.Webhook), false)
+		}
+		if serr != nil {
+			fmt.Printf("Error sending burst message to %s: %v\n", name, serr)
+		}
+	}
+}
+
+// buildBurstEmbed builds the burst message, times are shown in loc
+func buildBurstEmbed(serial string, session *SondeSession, burstLoc Place, hasLoc bool, loc *time.Location) DiscordEmbed {
+	burstTime := time.Unix(session.MaxAltTime, 0).In(loc)
+
+	var fields []DiscordField
+	fields = append(fields, DiscordField{
+		Name:  fmt.Sprintf("Burst altitude: %s ft (%s m)", humanize.Comma(int64(MetersToFeet(session.MaxAlt))), humanize.Comma(int64(session.MaxAlt))),
+		Value: zeroWidthSpace,
+	})
+
+	fields = append(fields, DiscordField{
+		Name:  fmt.Sprintf("Burst time: %s", burstTime.Format("3:04 PM")),
+		Value: zeroWidthSpace,
+	})
+
+	if hasLoc {
+		fields = append(fields, DiscordField{
+			Name:  fmt.Sprintf("Burst over %s", burstLoc),
+			Value: fmt.Sprintf("%.5f, %.5f", session.MaxAltLat, session.MaxAltLon),
+		})
+	}
+
+	// Compare against what SondeHub predicted before the burst
+	if session.PredBurstAlt > 0 {
+		diff := session.MaxAlt - session.PredBurstAlt
+		direction := "higher"
+		if diff < 0 {
+			direction = "lower"
+		}
+		fields = append(fields, DiscordField{
+			Name: fmt.Sprintf("Predicted burst: %s ft (%s m)", humanize.Comma(int64(MetersToFeet(session.PredBurstAlt))), humanize.Comma(int64(session.PredBurstAlt))),
+			Value: fmt.Sprintf("Actual burst was %s ft (%.1f%%) %s than predicted",
+				humanize.Comma(int64(math.Abs(MetersToFeet(diff)))), math.Abs(diff)/session.PredBurstAlt*100, direction),
+		})
+	}
+
+	return DiscordEmbed{
+		Type:   "rich",
+		Title:  PhaseBurst.EmbedTitle(session.SondeType, serial),
+		Color:  PhaseBurst.Style().Color,
+		Url:    fmt.Sprintf("https://sondehub.org/%s", serial),
+		Fields: fields,
+	}
+}
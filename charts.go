@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fogleman/gg"
+)
+
+const (
+	chartWidth  = 1280
+	chartHeight = 480
+	// Height of the title strip above the plots
+	chartHeader = 44
+	// Space around each plot for its title, ticks and axis labels
+	chartMarginLeft   = 62
+	chartMarginRight  = 16
+	chartMarginTop    = 28
+	chartMarginBottom = 44
+)
+
+// Charts are drawn on a dark background, so the light track colors from the map can be used as is
+var (
+	chartBackground = color.RGBA{R: 0x2B, G: 0x2D, B: 0x31, A: 255}
+	chartGridColor  = color.RGBA{R: 0x4E, G: 0x50, B: 0x58, A: 255}
+	chartTextColor  = color.RGBA{R: 0xDB, G: 0xDE, B: 0xE1, A: 255}
+)
+
+// chartPoint is one point of a plot, the line to it from the previous point is drawn in its color
+type chartPoint struct {
+	X, Y  float64
+	Color color.Color
+}
+
+// chartAxis is one axis of a plot. Format turns a tick value into its label, Zero marks zero with a
+// brighter line.
+type chartAxis struct {
+	Label    string
+	Min, Max float64
+	Step     float64
+	Format   func(float64) string
+	Zero     bool
+}
+
+// RenderTelemetryCharts renders altitude against time, temperature against altitude and the vertical
+// rate against time from a sonde's stored history, with the latest stored battery, satellite and signal
+// readings above them. The ascent and descent are drawn in the same colors as on the map.
+func RenderTelemetryCharts(session *SondeSession, history []HistoryEntry) (*bytes.Buffer, error) {
+	if len(history) < 2 {
+		return nil, errors.New("not enough history to chart")
+	}
+	pkt := history[len(history)-1].Packet
+
+	burst := session.Phase == PhaseBurst || session.Phase == PhaseDescent || session.Phase == PhaseLanded
+	trackColor := func(h HistoryEntry) color.Color {
+		if burst && h.Time > session.MaxAltTime {
+			return descentTrackColor
+		}
+		return ascentTrackColor
+	}
+
+	var altitude, temperature, rate []chartPoint
+	for _, h := range history {
+		c := trackColor(h)
+		altFt := MetersToFeet(h.Packet.Alt)
+		altitude = append(altitude, chartPoint{X: float64(h.Time), Y: altFt, Color: c})
+		rate = append(rate, chartPoint{X: float64(h.Time), Y: h.Packet.VelV, Color: c})
+		// Sondes without a temperature sensor leave it out, or send absolute zero
+		if hasTemperature(h.Packet) {
+			temperature = append(temperature, chartPoint{X: *h.Packet.Temp, Y: altFt, Color: c})
+		}
+	}
+
+	gc := gg.NewContext(chartWidth, chartHeight)
+	gc.SetColor(chartBackground)
+	gc.Clear()
+
+	gc.SetColor(chartTextColor)
+	gc.DrawStringAnchored(fmt.Sprintf("%s %s telemetry", defaultString(pkt.Subtype, pkt.Type), pkt.Serial), 16, chartHeader/2, 0, 0.35)
+	gc.DrawStringAnchored(latestReadings(pkt), chartWidth-16, chartHeader/2, 1, 0.35)
+
+	panelWidth := float64(chartWidth) / 3
+	panelHeight := float64(chartHeight - chartHeader)
+
+	timeAxis := chartAxis{
+		Label:  "Time (UTC)",
+		Min:    float64(history[0].Time),
+		Max:    float64(history[len(history)-1].Time),
+		Format: func(v float64) string { return time.Unix(int64(v), 0).UTC().Format("15:04") },
+	}
+	if timeAxis.Max <= timeAxis.Min {
+		timeAxis.Max = timeAxis.Min + 60
+	}
+	timeAxis.Step = timeStep(timeAxis.Max - timeAxis.Min)
+	altAxis := valueAxis("Altitude (ft)", altitude, func(p chartPoint) float64 { return p.Y }, false)
+	altAxis.Format = func(v float64) string { return humanize.Comma(int64(v)) }
+
+	drawChart(gc, 0, chartHeader, panelWidth, panelHeight, "Altitude", timeAxis, altAxis, altitude)
+
+	if len(temperature) > 1 {
+		tempAxis := valueAxis("Temperature (C)", temperature, func(p chartPoint) float64 { return p.X }, false)
+		drawChart(gc, panelWidth, chartHeader, panelWidth, panelHeight, "Temperature", tempAxis, altAxis, temperature)
+	} else {
+		drawChartMessage(gc, panelWidth, chartHeader, panelWidth, panelHeight, "Temperature", "No temperature reported")
+	}
+
+	rateAxis := valueAxis("Vertical rate (m/s)", rate, func(p chartPoint) float64 { return p.Y }, true)
+	drawChart(gc, 2*panelWidth, chartHeader, panelWidth, panelHeight, "Ascent rate", timeAxis, rateAxis, rate)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, gc.Image()); err != nil {
+		return nil, fmt.Errorf("png encode error: %w", err)
+	}
+	return buf, nil
+}
+
+// latestReadings summarizes the telemetry of the latest packet that isn't plotted
+func latestReadings(pkt SHPacket) string {
+	var parts []string
+	if pkt.Batt != 0 {
+		parts = append(parts, fmt.Sprintf("Battery %.1f V", pkt.Batt))
+	}
+	if pkt.Sats != 0 {
+		parts = append(parts, fmt.Sprintf("%d sats", pkt.Sats))
+	}
+	if pkt.Snr != 0 {
+		parts = append(parts, fmt.Sprintf("SNR %.1f dB", pkt.Snr))
+	}
+	if pkt.Humidity != 0 {
+		parts = append(parts, fmt.Sprintf("Humidity %.0f%%", pkt.Humidity))
+	}
+	parts = append(parts, fmt.Sprintf("Ground speed %.0f mph", pkt.VelH*2.23694))
+	return strings.Join(parts, "   ")
+}
+
+// valueAxis fits an axis to the values of the points, with a little room above and below.
+// With zero set, the axis always includes zero and marks it.
+func valueAxis(label string, points []chartPoint, value func(chartPoint) float64, zero bool) chartAxis {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		lo = math.Min(lo, value(p))
+		hi = math.Max(hi, value(p))
+	}
+	if zero {
+		lo = math.Min(lo, 0)
+		hi = math.Max(hi, 0)
+	}
+	if hi-lo < 1 {
+		lo, hi = lo-1, hi+1
+	}
+	pad := (hi - lo) * 0.05
+	axis := chartAxis{Label: label, Min: lo - pad, Max: hi + pad, Zero: zero}
+	axis.Step = niceStep((axis.Max - axis.Min) / 5)
+	axis.Format = func(v float64) string { return tickLabel(v, axis.Step) }
+	return axis
+}
+
+// niceStep rounds a tick interval up to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// timeStep picks a tick interval (seconds) for a time span that gives at most six ticks
+func timeStep(span float64) float64 {
+	for _, step := range []float64{60, 120, 300, 600, 900, 1800, 3600, 7200, 10800, 21600} {
+		if span/step <= 6 {
+			return step
+		}
+	}
+	return 43200
+}
+
+// tickLabel formats a tick value with only as many decimals as the tick step needs
+func tickLabel(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	return fmt.Sprintf("%.*f", decimals, v)
+}
+
+// drawChart draws one plot into the given area of the image: the title, a grid with tick labels, the
+// axis labels and the points joined up
+func drawChart(gc *gg.Context, x, y, w, h float64, title string, xAxis, yAxis chartAxis, points []chartPoint) {
+	left, top := x+chartMarginLeft, y+chartMarginTop
+	right, bottom := x+w-chartMarginRight, y+h-chartMarginBottom
+	px := func(v float64) float64 { return left + (v-xAxis.Min)/(xAxis.Max-xAxis.Min)*(right-left) }
+	py := func(v float64) float64 { return bottom - (v-yAxis.Min)/(yAxis.Max-yAxis.Min)*(bottom-top) }
+
+	gc.SetColor(chartTextColor)
+	gc.DrawStringAnchored(title, (left+right)/2, y+chartMarginTop/2, 0.5, 0.35)
+
+	gc.SetLineWidth(1)
+	for v := math.Ceil(xAxis.Min/xAxis.Step) * xAxis.Step; v <= xAxis.Max; v += xAxis.Step {
+		gc.SetColor(chartGridColor)
+		gc.DrawLine(px(v), top, px(v), bottom)
+		gc.Stroke()
+		gc.SetColor(chartTextColor)
+		gc.DrawStringAnchored(xAxis.Format(v), px(v), bottom+12, 0.5, 0.35)
+	}
+	for v := math.Ceil(yAxis.Min/yAxis.Step) * yAxis.Step; v <= yAxis.Max; v += yAxis.Step {
+		gc.SetColor(chartGridColor)
+		gc.DrawLine(left, py(v), right, py(v))
+		gc.Stroke()
+		gc.SetColor(chartTextColor)
+		gc.DrawStringAnchored(yAxis.Format(v), left-6, py(v), 1, 0.35)
+	}
+	// A brighter line at zero, so ascent and descent rates are easy to tell apart
+	if yAxis.Zero {
+		gc.SetColor(chartTextColor)
+		gc.DrawLine(left, py(0), right, py(0))
+		gc.Stroke()
+	}
+	gc.SetColor(chartGridColor)
+	gc.DrawRectangle(left, top, right-left, bottom-top)
+	gc.Stroke()
+
+	gc.SetColor(chartTextColor)
+	gc.DrawStringAnchored(xAxis.Label, (left+right)/2, bottom+32, 0.5, 0.35)
+	gc.Push()
+	gc.RotateAbout(-math.Pi/2, x+14, (top+bottom)/2)
+	gc.DrawStringAnchored(yAxis.Label, x+14, (top+bottom)/2, 0.5, 0.35)
+	gc.Pop()
+
+	gc.SetLineWidth(2)
+	for i := 1; i < len(points); i++ {
+		gc.SetColor(points[i].Color)
+		gc.DrawLine(px(points[i-1].X), py(points[i-1].Y), px(points[i].X), py(points[i].Y))
+		gc.Stroke()
+	}
+}
+
+// drawChartMessage fills a plot area with a message, for telemetry the sonde doesn't send
+func drawChartMessage(gc *gg.Context, x, y, w, h float64, title, msg string) {
+	gc.SetColor(chartTextColor)
+	gc.DrawStringAnchored(title, x+w/2, y+chartMarginTop/2, 0.5, 0.35)
+	gc.DrawStringAnchored(msg, x+w/2, y+h/2, 0.5, 0.35)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// ChaseMember is a chase team member, notified when a sonde is predicted to land within their range
+type ChaseMember struct {
+	Name       string   `json:"name"`
+	Lat        float64  `json:"lat"` // Home or base location
+	Lon        float64  `json:"lon"`
+	DiscordID  string   `json:"discordId,omitempty"`  // Discord user ID to @-mention
+	MaxMiles   float64  `json:"maxMiles"`             // Furthest they'll drive, in a straight line from home
+	SondeTypes []string `json:"sondeTypes,omitempty"` // e.g. RS41, DFM; empty means every type
+	Webhook    string   `json:"webhook,omitempty"`    // Personal webhook, instead of mentioning them in the region channels
+}
+
+// WantsType returns true if the member cares about this sonde type (or subtype)
+func (m ChaseMember) WantsType(pkt SHPacket) bool {
+	if len(m.SondeTypes) == 0 {
+		return true
+	}
+	for _, t := range m.SondeTypes {
+		if strings.EqualFold(t, pkt.Type) || strings.EqualFold(t, pkt.Subtype) {
+			return true
+		}
+	}
+	return false
+}
+
+// chaseMembersInRange returns the members wanting this sonde whose range covers the predicted landing,
+// and that haven't been notified about it yet
+func chaseMembersInRange(pkt SHPacket, session *SondeSession, shPred *SHPredictionResult) []ChaseMember {
+	members, err := redisclient.ChaseMembers()
+	if err != nil {
+		fmt.Println("Error loading chase team:", err)
+		return nil
+	}
+	var inRange []ChaseMember
+	for _, m := range members {
+		if slices.Contains(session.ChaseNotified, m.Name) || !m.WantsType(pkt) {
+			continue
+		}
+		if haversineMiles(m.Lat, m.Lon, shPred.Latitude, shPred.Longitude) <= m.MaxMiles {
+			inRange = append(inRange, m)
+		}
+	}
+	return inRange
+}
+
+// notifyChaseTeam lets every chase team member in range know once per flight. Members with their own
+// webhook get a message there, the others are mentioned in a new message in each of the sonde's region channels.
+func notifyChaseTeam(pkt SHPacket, session *SondeSession, shPred *SHPredictionResult, predLoc Place) {
+	members := chaseMembersInRange(pkt, session, shPred)
+	if len(members) == 0 {
+		return
+	}
+
+	notice := func(m ChaseMember) string {
+		// Discord shows <t:...:t> in each reader's own timezone
+		return fmt.Sprintf("**%s** is predicted to land near %s around <t:%d:t>, %.1f mi from %s",
+			pkt.Serial, predLoc, shPred.Time.Unix(), haversineMiles(m.Lat, m.Lon, shPred.Latitude, shPred.Longitude), m.Name)
+	}
+	mention := func(m ChaseMember) string {
+		if m.DiscordID == "" {
+			return ""
+		}
+		return fmt.Sprintf("<@%s> ", m.DiscordID)
+	}
+	link := fmt.Sprintf("https://sondehub.org/%s", pkt.Serial)
+
+	var lines []string
+	var userIDs []string
+	for _, m := range members {
+		if m.Webhook != "" {
+			msg := DiscordMessage{
+				Content:         fmt.Sprintf("%s%s\n%s", mention(m), notice(m), link),
+				AllowedMentions: mentionOnly(m.DiscordID),
+			}
+			if _, err := SendDiscordWebhook(msg, m.Webhook, false); err != nil {
+				fmt.Printf("Error notifying %s: %v\n", m.Name, err)
+				continue
+			}
+		} else {
+			if m.DiscordID == "" {
+				// Nothing to mention them with
+				continue
+			}
+			lines = append(lines, mention(m)+notice(m))
+			userIDs = append(userIDs, m.DiscordID)
+		}
+		fmt.Printf("%s: notified chase team member %s\n", pkt.Serial, m.Name)
+		session.ChaseNotified = append(session.ChaseNotified, m.Name)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	// Edits never ping anyone, so the mentions go out as a new message next to the sonde's own
+	msg := DiscordMessage{
+		Content:         strings.Join(lines, "\n") + "\n" + link,
+		AllowedMentions: mentionOnly(userIDs...),
+	}
+	for name, regionMsg := range session.Regions {
+		if _, err := SendDiscordWebhook(msg, webhookBaseURL(regionMsg.Webhook), false); err != nil {
+			fmt.Printf("Error mentioning chase team in %s: %v\n", name, err)
+		}
+	}
+}
+
+// runChaseCommand manages the chase team registry stored in Redis
+func runChaseCommand(args []string) error {
+	usage := errors.New("usage: balloony chase list | balloony chase add [flags] <name> | balloony chase remove <name>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "list":
+		members, err := redisclient.ChaseMembers()
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			fmt.Println("No chase team members")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tLOCATION\tMAX MILES\tDISCORD ID\tSONDE TYPES\tWEBHOOK")
+		for _, m := range members {
+			fmt.Fprintf(w, "%s\t%.4f, %.4f\t%.0f\t%s\t%s\t%t\n", m.Name, m.Lat, m.Lon, m.MaxMiles,
+				defaultString(m.DiscordID, "-"), defaultString(strings.Join(m.SondeTypes, ","), "all"), m.Webhook != "")
+		}
+		return w.Flush()
+
+	case "add":
+		fs := flag.NewFlagSet("chase add", flag.ExitOnError)
+		lat := fs.Float64("lat", 0, "latitude of the member's home or base")
+		lon := fs.Float64("lon", 0, "longitude of the member's home or base")
+		maxMiles := fs.Float64("max-miles", 50, "furthest the member will drive, in miles")
+		discordID := fs.String("discord", "", "Discord user ID to @-mention")
+		types := fs.String("types", "", "comma separated sonde types to notify about, e.g. RS41,DFM (default all)")
+		webhook := fs.String("webhook", "", "personal webhook to notify instead of the region channels")
+		fs.Usage = func() {
+			fmt.Fprintln(fs.Output(), "Usage: balloony chase add -lat N -lon N [-max-miles N] [-discord ID] [-types T,...] [-webhook URL] <name>")
+			fs.PrintDefaults()
+		}
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errors.New("a name is required")
+		}
+		member := ChaseMember{
+			Name:      fs.Arg(0),
+			Lat:       *lat,
+			Lon:       *lon,
+			DiscordID: *discordID,
+			MaxMiles:  *maxMiles,
+			Webhook:   *webhook,
+		}
+		for _, t := range strings.Split(*types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				member.SondeTypes = append(member.SondeTypes, t)
+			}
+		}
+		if member.Lat < -90 || member.Lat > 90 || member.Lon < -180 || member.Lon > 180 || (member.Lat == 0 && member.Lon == 0) {
+			return errors.New("-lat and -lon must be a valid location")
+		}
+		if member.MaxMiles <= 0 {
+			return errors.New("-max-miles must be greater than 0")
+		}
+		if member.DiscordID == "" && member.Webhook == "" {
+			return errors.New("-discord and/or -webhook is required to notify the member")
+		}
+		if err := redisclient.SaveChaseMember(member); err != nil {
+			return err
+		}
+		fmt.Println("Saved chase team member", member.Name)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return usage
+		}
+		removed, err := redisclient.RemoveChaseMember(args[1])
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("no chase team member named %q", args[1])
+		}
+		fmt.Println("Removed chase team member", args[1])
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time.Now so recorded flights can be replayed with their original timing
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock used during normal operation
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// VirtualClock is a Clock that only moves when Set is called, used by the replay command
+type VirtualClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Set moves the virtual clock to t
+func (c *VirtualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// clock is the time source for all session and throttling logic
+var clock Clock = systemClock{}
@@ -0,0 +1,746 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default location of the configuration file, overridden by CONFIG_FILE
+const defaultConfigFile = "balloony.yaml"
+
+// Config is the full Balloony configuration. It is loaded from a YAML file, then every field with an
+// env tag can be overridden by that environment variable, so existing .env deployments keep working.
+type Config struct {
+	RadarAPIKey          string                   `yaml:"radar_api_key" env:"RADAR_API_KEY"`
+	DiscordWebhookURL    string                   `yaml:"discord_webhook_url" env:"DISCORD_WEBHOOK_URL"`
+	AlertBounds          [][]float64              `yaml:"alert_bounds" env:"ALERT_BOUNDS"`
+	AlertBoundaryFile    string                   `yaml:"alert_boundary_file" env:"ALERT_BOUNDARY_FILE"`
+	UpdateInterval       int64                    `yaml:"update_interval" env:"UPDATE_INTERVAL"`
+	Timezone             string                   `yaml:"timezone" env:"TIMEZONE"`
+	MessageUsual         string                   `yaml:"message_usual" env:"MESSAGE_USUAL"`
+	MessageUnusual       string                   `yaml:"message_unusual" env:"MESSAGE_UNUSUAL"`
+	MessageDrift         string                   `yaml:"message_drift" env:"MESSAGE_DRIFT"`
+	BypassLocationFilter bool                     `yaml:"bypass_location_filter" env:"BYPASS_LOCATION_FILTER"`
+	LaunchSitesFile      string                   `yaml:"launch_sites_file" env:"LAUNCH_SITES_FILE"`
+	RegionsFile          string                   `yaml:"regions_file" env:"REGIONS_FILE"`
+	Regions              []*Region                `yaml:"regions"`
+	LostSignalTimeout    int64                    `yaml:"lost_signal_timeout" env:"LOST_SIGNAL_TIMEOUT"`
+	RecordFile           string                   `yaml:"record_file" env:"RECORD_FILE"`
+	TelemetrySources     []string                 `yaml:"telemetry_sources" env:"TELEMETRY_SOURCES"`
+	PredictionTracking   PredictionTrackingConfig `yaml:"prediction_tracking"`
+	Geocoding            GeocodingConfig          `yaml:"geocoding"`
+	Driving              DrivingConfig            `yaml:"driving"`
+	History              HistoryConfig            `yaml:"history"`
+	Export               ExportConfig             `yaml:"export"`
+	AutoRX               AutoRXConfig             `yaml:"autorx"`
+	MQTT                 MQTTConfig               `yaml:"mqtt"`
+	Redis                RedisConfig              `yaml:"redis"`
+	Map                  MapConfig                `yaml:"map"`
+
+	// Derived while loading
+	launchSites  []Point
+	geocoder     Geocoder
+	placeFormats map[string]*template.Template
+	lines        map[string]int    // YAML path -> line number
+	envSources   map[string]string // YAML path -> environment variable that overrode it
+}
+
+// AutoRXConfig configures the radiosonde_auto_rx UDP listener
+type AutoRXConfig struct {
+	Addr string `yaml:"addr" env:"AUTORX_UDP_ADDR"`
+	Port int    `yaml:"port" env:"AUTORX_UDP_PORT"`
+}
+
+// PredictionTrackingConfig configures watching sondes outside every region for a predicted path into one
+type PredictionTrackingConfig struct {
+	Enabled            bool    `yaml:"enabled" env:"PREDICTION_TRACKING"`
+	MaxDistanceMiles   float64 `yaml:"max_distance_miles" env:"PREDICTION_TRACKING_MAX_DISTANCE"`
+	CheckInterval      int64   `yaml:"check_interval" env:"PREDICTION_TRACKING_INTERVAL"`
+	MaxChecksPerMinute int     `yaml:"max_checks_per_minute" env:"PREDICTION_TRACKING_RATE"`
+}
+
+// GeocodingConfig configures reverse geocoding
+type GeocodingConfig struct {
+	// Tried in order until one finds a place: radar, nominatim, photon, offline
+	Backends []string `yaml:"backends" env:"GEOCODERS"`
+	// Preferred language for place names from nominatim and photon, e.g. de
+	Language  string                `yaml:"language" env:"GEOCODER_LANGUAGE"`
+	Nominatim NominatimConfig       `yaml:"nominatim"`
+	Photon    PhotonConfig          `yaml:"photon"`
+	Offline   OfflineGeocoderConfig `yaml:"offline"`
+	Cache     GeocodeCacheConfig    `yaml:"cache"`
+	// Place name templates keyed by country code, with "default" for everywhere else
+	Formats map[string]string `yaml:"formats"`
+}
+
+// RedisConfig configures the Redis connection
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+}
+
+// MapConfig configures map rendering
+type MapConfig struct {
+	TileCacheDir        string `yaml:"tile_cache_dir" env:"TILE_CACHE_DIR"`
+	SatelliteAltitudeFt int    `yaml:"satellite_altitude_ft" env:"MAP_SATELLITE_ALTITUDE_FT"`
+	// Attach an animated GIF of the whole flight to the landing summary
+	Animation bool `yaml:"animation" env:"MAP_ANIMATION"`
+	// Attach altitude, temperature and ascent rate charts to the updates and the landing summary
+	Charts bool `yaml:"charts" env:"MAP_CHARTS"`
+	// Post a Skew-T diagram of the ascent with the burst message
+	Sounding bool `yaml:"sounding" env:"MAP_SOUNDING"`
+	// Named layouts for the update map, regions pick one with map_profile
+	Profiles map[string]*MapProfile `yaml:"profiles"`
+	// Tile servers and local tile files, by name, for the profiles to use besides the built in ones
+	TileProviders map[string]*TileProviderConfig `yaml:"tile_providers"`
+	// User-Agent for tile requests, tile servers like OpenStreetMap's want it to identify the deployment
+	UserAgent string `yaml:"user_agent" env:"MAP_USER_AGENT"`
+}
+
+// ConfigError is a single configuration problem, with the line it came from when known
+type ConfigError struct {
+	Path string
+	Line int
+	Env  string
+	Msg  string
+}
+
+func (e ConfigError) Error() string {
+	switch {
+	case e.Env != "":
+		return fmt.Sprintf("%s (from $%s): %s", e.Path, e.Env, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Path, e.Msg)
+	case e.Path != "":
+		return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+	}
+	return e.Msg
+}
+
+var (
+	config   *Config
+	configMu sync.RWMutex
+)
+
+// currentConfig returns the active configuration. The returned value must not be modified,
+// a reload swaps in a whole new Config instead.
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+func setConfig(cfg *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = cfg
+}
+
+// configFilePath returns CONFIG_FILE, or the default file if it exists, or "" to run from the environment only
+func configFilePath() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile
+	}
+	return ""
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Timezone:          "Etc/UTC",
+		MessageUsual:      "A new sonde has been detected!",
+		MessageUnusual:    "Unusual Sonde Detected!",
+		MessageDrift:      "A sonde is drifting into your area!",
+		LaunchSitesFile:   "launchsites.json",
+		LostSignalTimeout: defaultLostSignalTimeout,
+		TelemetrySources:  []string{"sondehub"},
+		PredictionTracking: PredictionTrackingConfig{
+			MaxDistanceMiles:   150,
+			CheckInterval:      5 * 60,
+			MaxChecksPerMinute: 20,
+		},
+		Geocoding: GeocodingConfig{
+			Backends: []string{"radar"},
+			Nominatim: NominatimConfig{
+				URL:       "https://nominatim.openstreetmap.org",
+				UserAgent: "balloony (https://github.com/mrarm/balloony)",
+			},
+			Photon:  PhotonConfig{URL: "https://photon.komoot.io"},
+			Offline: OfflineGeocoderConfig{MaxPlaceMiles: 10},
+			Cache: GeocodeCacheConfig{
+				Enabled:   true,
+				Precision: 7,
+				TTL:       30 * 24 * 60 * 60,
+			},
+			Formats: maps.Clone(defaultPlaceFormats),
+		},
+		Driving: DrivingConfig{
+			Receivers:         1,
+			MaxMiles:          60,
+			MaxRequestsPerDay: 2000,
+			CacheTTL:          6 * 60 * 60,
+		},
+		History: HistoryConfig{
+			Interval:  5,
+			Retention: 7 * 24 * 60 * 60,
+		},
+		AutoRX: AutoRXConfig{Port: defaultAutoRXPort},
+		MQTT: MQTTConfig{
+			Broker:   "wss://ws-reader.v2.sondehub.org:443",
+			ClientID: "balloonyv2",
+			Topics:   []string{"batch"},
+			QoS:      1,
+		},
+		Redis: RedisConfig{Addr: "localhost:6379"},
+		Map: MapConfig{
+			TileCacheDir:        "tilecache",
+			SatelliteAltitudeFt: 10000,
+			Animation:           true,
+			Charts:              true,
+			Sounding:            true,
+			UserAgent:           "balloony (https://github.com/mrarm/balloony)",
+		},
+		lines:      make(map[string]int),
+		envSources: make(map[string]string),
+	}
+}
+
+// LoadConfig reads the configuration file at path (if any), applies environment overrides and validates the
+// result. Every problem found is returned, not just the first one.
+func LoadConfig(path string) (*Config, []ConfigError) {
+	cfg := defaultConfig()
+	var errs []ConfigError
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, []ConfigError{{Msg: err.Error()}}
+		}
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, []ConfigError{{Msg: err.Error()}}
+		}
+		if len(root.Content) > 0 {
+			doc := root.Content[0]
+			indexLines(doc, "", cfg.lines)
+			checkUnknownKeys(doc, reflect.TypeOf(*cfg), "", &errs)
+			if err := doc.Decode(cfg); err != nil {
+				var typeErr *yaml.TypeError
+				if errors.As(err, &typeErr) {
+					for _, msg := range typeErr.Errors {
+						errs = append(errs, ConfigError{Msg: msg})
+					}
+				} else {
+					errs = append(errs, ConfigError{Msg: err.Error()})
+				}
+			}
+		}
+	}
+
+	applyEnvOverrides(reflect.ValueOf(cfg).Elem(), "", cfg.envSources, &errs)
+
+	if cfg.RegionsFile != "" {
+		fileRegions, err := LoadRegionsJSON(cfg.RegionsFile)
+		if err != nil {
+			errs = append(errs, cfg.errorAt("regions_file", err.Error()))
+		}
+		cfg.Regions = append(cfg.Regions, fileRegions...)
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// errorAt builds a ConfigError for a YAML path, pointing at its line or the environment variable that set it
+func (cfg *Config) errorAt(path, msg string) ConfigError {
+	e := ConfigError{Path: path, Msg: msg}
+	// Items of a list set from the environment, e.g. export.attach[1], point at the variable
+	for p := path; p != ""; p = parentPath(p) {
+		if env, ok := cfg.envSources[p]; ok {
+			e.Env = env
+			return e
+		}
+	}
+	// Missing settings point at the closest parent that exists, e.g. the region they are missing from
+	for p := path; p != "" && e.Line == 0; p = parentPath(p) {
+		e.Line = cfg.lines[p]
+	}
+	return e
+}
+
+// parentPath returns the path one level up, e.g. regions[0] for regions[0].webhook and regions for regions[0]
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// validate checks everything that can't be expressed by the YAML types alone and derives the runtime state
+func (cfg *Config) validate() []ConfigError {
+	var errs []ConfigError
+
+	usesRadar := false
+	for _, name := range cfg.Geocoding.Backends {
+		usesRadar = usesRadar || strings.EqualFold(name, "radar")
+	}
+	for i, format := range cfg.Export.Attach {
+		if _, ok := exportFormats[strings.ToLower(format)]; !ok {
+			errs = append(errs, cfg.errorAt(fmt.Sprintf("export.attach[%d]", i), fmt.Sprintf("unknown export format %q, expected gpx, kml or csv", format)))
+		}
+	}
+	if cfg.History.Interval < 0 {
+		errs = append(errs, cfg.errorAt("history.interval", "can't be negative"))
+	}
+	if cfg.History.Retention <= 0 {
+		errs = append(errs, cfg.errorAt("history.retention", "must be greater than 0"))
+	}
+	if cfg.RadarAPIKey == "" && cfg.Driving.Enabled {
+		errs = append(errs, cfg.errorAt("radar_api_key", "is required for driving estimates"))
+	}
+	if cfg.Driving.Enabled {
+		if cfg.Driving.Receivers < 0 {
+			errs = append(errs, cfg.errorAt("driving.receivers", "can't be negative"))
+		}
+		if cfg.Driving.MaxMiles <= 0 {
+			errs = append(errs, cfg.errorAt("driving.max_miles", "must be greater than 0"))
+		}
+		if cfg.Driving.MaxRequestsPerDay <= 0 {
+			errs = append(errs, cfg.errorAt("driving.max_requests_per_day", "must be greater than 0"))
+		}
+		if cfg.Driving.CacheTTL <= 0 {
+			errs = append(errs, cfg.errorAt("driving.cache_ttl", "must be greater than 0"))
+		}
+	}
+	if cfg.RadarAPIKey == "" && usesRadar {
+		errs = append(errs, cfg.errorAt("radar_api_key", "is required when the radar geocoder is used"))
+	}
+	if cfg.Geocoding.Cache.Enabled {
+		if cfg.Geocoding.Cache.Precision < 1 || cfg.Geocoding.Cache.Precision > 12 {
+			errs = append(errs, cfg.errorAt("geocoding.cache.precision", "must be between 1 and 12"))
+		}
+		if cfg.Geocoding.Cache.TTL <= 0 {
+			errs = append(errs, cfg.errorAt("geocoding.cache.ttl", "must be greater than 0"))
+		}
+	}
+	if len(cfg.Geocoding.Backends) == 0 {
+		errs = append(errs, cfg.errorAt("geocoding.backends", "at least one geocoder is required"))
+	} else if g, err := newGeocoder(cfg.Geocoding); err != nil {
+		errs = append(errs, cfg.errorAt("geocoding", err.Error()))
+	} else {
+		cfg.geocoder = g
+	}
+	formats, err := parsePlaceFormats(cfg.Geocoding.Formats)
+	if err != nil {
+		errs = append(errs, cfg.errorAt("geocoding.formats", err.Error()))
+	}
+	cfg.placeFormats = formats
+
+	// Without explicit regions, the top level settings describe the single default region
+	if len(cfg.Regions) == 0 {
+		before := len(errs)
+		if len(cfg.AlertBounds) == 0 && cfg.AlertBoundaryFile == "" {
+			errs = append(errs, cfg.errorAt("alert_bounds", "is required when no regions are defined (or set alert_boundary_file)"))
+		}
+		if cfg.DiscordWebhookURL == "" {
+			errs = append(errs, cfg.errorAt("discord_webhook_url", "is required when no regions are defined"))
+		}
+		if cfg.UpdateInterval == 0 {
+			errs = append(errs, cfg.errorAt("update_interval", "is required when no regions are defined"))
+		}
+		if len(errs) == before {
+			cfg.Regions = []*Region{{Name: defaultRegionName, Bounds: cfg.AlertBounds, BoundaryFile: cfg.AlertBoundaryFile}}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Map.TileProviders)) {
+		if cfg.Map.TileProviders[name] == nil {
+			cfg.Map.TileProviders[name] = &TileProviderConfig{}
+		}
+		for _, e := range cfg.Map.TileProviders[name].validate(name) {
+			errs = append(errs, cfg.errorAt("map.tile_providers."+name+"."+e.field, e.msg))
+		}
+	}
+
+	// Profiles are filled in from the default profile, which is filled in from the built in one
+	if cfg.Map.Profiles == nil {
+		cfg.Map.Profiles = make(map[string]*MapProfile)
+	}
+	base := cfg.Map.Profiles[defaultMapProfileName]
+	if base == nil {
+		base = &MapProfile{}
+		cfg.Map.Profiles[defaultMapProfileName] = base
+	}
+	for _, e := range base.validate(defaultMapProfile(), cfg.Map.TileProviders) {
+		errs = append(errs, cfg.errorAt("map.profiles."+defaultMapProfileName+"."+e.field, e.msg))
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Map.Profiles)) {
+		if name == defaultMapProfileName {
+			continue
+		}
+		if cfg.Map.Profiles[name] == nil {
+			cfg.Map.Profiles[name] = &MapProfile{}
+		}
+		for _, e := range cfg.Map.Profiles[name].validate(base, cfg.Map.TileProviders) {
+			errs = append(errs, cfg.errorAt("map.profiles."+name+"."+e.field, e.msg))
+		}
+	}
+
+	defaults := Region{
+		MapProfile:     defaultMapProfileName,
+		Webhook:        cfg.DiscordWebhookURL,
+		Timezone:       cfg.Timezone,
+		MessageUsual:   cfg.MessageUsual,
+		MessageUnusual: cfg.MessageUnusual,
+		MessageDrift:   cfg.MessageDrift,
+		UpdateInterval: cfg.UpdateInterval,
+	}
+	seen := make(map[string]bool)
+	for i, r := range cfg.Regions {
+		path := fmt.Sprintf("regions[%d]", i)
+		for _, e := range r.validate(defaults) {
+			errs = append(errs, cfg.errorAt(path+"."+e.field, e.msg))
+		}
+		if _, ok := cfg.Map.Profiles[r.MapProfile]; !ok {
+			errs = append(errs, cfg.errorAt(path+".map_profile", fmt.Sprintf("unknown map profile %q", r.MapProfile)))
+		}
+		if r.Name != "" && seen[r.Name] {
+			errs = append(errs, cfg.errorAt(path+".name", fmt.Sprintf("region %s is defined more than once", r.Name)))
+		}
+		seen[r.Name] = true
+	}
+
+	sites, err := ParseLaunchSitesJSON(cfg.LaunchSitesFile)
+	if err != nil {
+		errs = append(errs, cfg.errorAt("launch_sites_file", err.Error()))
+	}
+	cfg.launchSites = sites
+
+	if cfg.LostSignalTimeout <= 0 {
+		errs = append(errs, cfg.errorAt("lost_signal_timeout", "must be greater than 0"))
+	}
+	if len(cfg.TelemetrySources) == 0 {
+		errs = append(errs, cfg.errorAt("telemetry_sources", "at least one source is required"))
+	}
+	for i, name := range cfg.TelemetrySources {
+		if !isKnownTelemetrySource(name) {
+			errs = append(errs, cfg.errorAt(fmt.Sprintf("telemetry_sources[%d]", i), fmt.Sprintf("unknown telemetry source %q", name)))
+		}
+	}
+	if cfg.PredictionTracking.Enabled {
+		if cfg.PredictionTracking.MaxDistanceMiles <= 0 {
+			errs = append(errs, cfg.errorAt("prediction_tracking.max_distance_miles", "must be greater than 0"))
+		}
+		if cfg.PredictionTracking.CheckInterval <= 0 {
+			errs = append(errs, cfg.errorAt("prediction_tracking.check_interval", "must be greater than 0"))
+		}
+		if cfg.PredictionTracking.MaxChecksPerMinute <= 0 {
+			errs = append(errs, cfg.errorAt("prediction_tracking.max_checks_per_minute", "must be greater than 0"))
+		}
+	}
+	if cfg.AutoRX.Port <= 0 || cfg.AutoRX.Port > 65535 {
+		errs = append(errs, cfg.errorAt("autorx.port", "must be a valid UDP port"))
+	}
+	if cfg.MQTT.Broker == "" {
+		errs = append(errs, cfg.errorAt("mqtt.broker", "is required"))
+	}
+	if len(cfg.MQTT.Topics) == 0 {
+		errs = append(errs, cfg.errorAt("mqtt.topics", "at least one topic is required"))
+	}
+	if cfg.MQTT.QoS > 2 {
+		errs = append(errs, cfg.errorAt("mqtt.qos", "must be 0, 1 or 2"))
+	}
+	if cfg.MQTT.ClientCert != "" && cfg.MQTT.ClientKey == "" {
+		errs = append(errs, cfg.errorAt("mqtt.tls_key", "is required when tls_cert is set"))
+	}
+	return errs
+}
+
+// indexLines records the line of every key and list item in the document, keyed by path (e.g. regions[0].webhook)
+func indexLines(node *yaml.Node, path string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			lines[key] = node.Content[i].Line
+			indexLines(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			lines[key] = item.Line
+			indexLines(item, key, lines)
+		}
+	}
+}
+
+// checkUnknownKeys reports keys that don't map to a field, catching typos that would otherwise be silently ignored
+func checkUnknownKeys(node *yaml.Node, t reflect.Type, path string, errs *[]ConfigError) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		if t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode {
+			for i, item := range node.Content {
+				checkUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+			return
+		}
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Map && node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkUnknownKeys(node.Content[i+1], t.Elem(), path+"."+node.Content[i].Value, errs)
+		}
+		return
+	}
+	if t.Kind() != reflect.Struct || node.Kind != yaml.MappingNode {
+		return
+	}
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		if name := yamlName(t.Field(i)); name != "" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		ft, ok := fields[key]
+		if !ok {
+			*errs = append(*errs, ConfigError{Path: keyPath, Line: node.Content[i].Line, Msg: "unknown setting"})
+			continue
+		}
+		checkUnknownKeys(node.Content[i+1], ft, keyPath, errs)
+	}
+}
+
+// yamlName returns the YAML key for a struct field, "" if it isn't part of the file
+func yamlName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// applyEnvOverrides sets every field with an env tag from its environment variable, if set
+func applyEnvOverrides(v reflect.Value, path string, sources map[string]string, errs *[]ConfigError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := yamlName(f)
+		if name == "" {
+			continue
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		fv := v.Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			applyEnvOverrides(fv, fieldPath, sources, errs)
+			continue
+		}
+		env := f.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		raw := os.Getenv(env)
+		if raw == "" {
+			continue
+		}
+		sources[fieldPath] = env
+		if err := setFromString(fv, raw); err != nil {
+			*errs = append(*errs, ConfigError{Path: fieldPath, Env: env, Msg: err.Error()})
+		}
+	}
+}
+
+// setFromString parses an environment variable into a field. Lists of strings are comma separated,
+// anything more complicated (e.g. ALERT_BOUNDS) is JSON.
+func setFromString(fv reflect.Value, raw string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		fv.SetBool(raw == "true" || raw == "1")
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		fv.SetInt(n)
+	case reflect.Uint8:
+		n, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 8)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		fv.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.String {
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			fv.Set(reflect.ValueOf(list))
+			return nil
+		}
+		ptr := reflect.New(fv.Type())
+		if err := json.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		fv.Set(ptr.Elem())
+	default:
+		return fmt.Errorf("can't be set from the environment")
+	}
+	return nil
+}
+
+// loadStartupConfig loads the configuration for the bot and subcommands, exiting with every problem listed if it is invalid
+func loadStartupConfig() {
+	path := configFilePath()
+	cfg, errs := LoadConfig(path)
+	if len(errs) > 0 {
+		printConfigErrors(path, errs)
+		os.Exit(1)
+	}
+	setConfig(cfg)
+	if path != "" {
+		fmt.Println("Loaded configuration from", path)
+	}
+	if cfg.BypassLocationFilter {
+		fmt.Println("Bypass location filter is enabled. All sondes will be processed regardless of location.")
+	}
+	fmt.Printf("Loaded %d alert region(s)\n", len(cfg.Regions))
+}
+
+// reloadConfig re-reads the configuration on SIGHUP. Regions, messages, webhooks and launch sites take effect
+// right away; connection settings are kept as they are until the next restart.
+func reloadConfig() {
+	path := configFilePath()
+	cfg, errs := LoadConfig(path)
+	if len(errs) > 0 {
+		fmt.Println("[!] Configuration reload failed, keeping the current configuration:")
+		printConfigErrors(path, errs)
+		return
+	}
+	old := currentConfig()
+	if !reflect.DeepEqual(old.MQTT, cfg.MQTT) || !reflect.DeepEqual(old.Redis, cfg.Redis) ||
+		!reflect.DeepEqual(old.AutoRX, cfg.AutoRX) || !reflect.DeepEqual(old.TelemetrySources, cfg.TelemetrySources) ||
+		old.RecordFile != cfg.RecordFile {
+		fmt.Println("[!] Telemetry source, Redis and recording changes only take effect after a restart")
+	}
+	setConfig(cfg)
+	fmt.Printf("[*] Configuration reloaded: %d alert region(s), %d launch sites\n", len(cfg.Regions), len(cfg.launchSites))
+}
+
+func printConfigErrors(path string, errs []ConfigError) {
+	name := defaultString(path, "environment")
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, e.Error())
+	}
+}
+
+// runConfigCommand implements `balloony config validate [file]` and `balloony config schema`
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: balloony config validate [file] | balloony config schema")
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		path := configFilePath()
+		if len(args) > 1 {
+			path = args[1]
+		}
+		_, errs := LoadConfig(path)
+		if len(errs) > 0 {
+			printConfigErrors(path, errs)
+			fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(errs))
+			return 1
+		}
+		fmt.Println("Configuration OK")
+		return 0
+	case "schema":
+		schema := jsonSchema(reflect.TypeOf(Config{}))
+		schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+		schema["title"] = "Balloony configuration"
+		out, _ := json.MarshalIndent(schema, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Unknown config command %s\n", args[0])
+	return 2
+}
+
+// jsonSchema describes a config type as JSON Schema, for editor completion and validation of the YAML file
+func jsonSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := yamlName(f)
+			if name == "" {
+				continue
+			}
+			prop := jsonSchema(f.Type)
+			if env := f.Tag.Get("env"); env != "" {
+				prop["description"] = "Overridden by $" + env
+			}
+			props[name] = prop
+		}
+		return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint8:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
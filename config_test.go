@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// minimalConfig is the smallest valid configuration, tests append the settings they are about
+const minimalConfig = `radar_api_key: test
+discord_webhook_url: https://discord.com/api/webhooks/1/test
+update_interval: 300
+alert_bounds: [[-90, 40], [-89, 40], [-89, 41], [-90, 41]]
+`
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "balloony.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigEnvOverridesNestedField(t *testing.T) {
+	path := writeConfig(t, minimalConfig+`redis:
+  addr: yaml:6379
+mqtt:
+  topics: [batch]
+`)
+	t.Setenv("REDIS_ADDR", "env:6379")
+	t.Setenv("MQTT_TOPICS", "sondes/+, batch")
+
+	cfg, errs := LoadConfig(path)
+	if len(errs) > 0 {
+		t.Fatalf("LoadConfig() errors: %v", errs)
+	}
+	if cfg.Redis.Addr != "env:6379" {
+		t.Errorf("redis.addr = %q, want the REDIS_ADDR value", cfg.Redis.Addr)
+	}
+	if want := []string{"sondes/+", "batch"}; !reflect.DeepEqual(cfg.MQTT.Topics, want) {
+		t.Errorf("mqtt.topics = %q, want %q", cfg.MQTT.Topics, want)
+	}
+	if cfg.envSources["redis.addr"] != "REDIS_ADDR" {
+		t.Errorf("redis.addr source = %q, want REDIS_ADDR", cfg.envSources["redis.addr"])
+	}
+}
+
+func TestLoadConfigEnvErrorNamesVariable(t *testing.T) {
+	path := writeConfig(t, minimalConfig)
+	t.Setenv("MQTT_QOS", "3")
+
+	_, errs := LoadConfig(path)
+	if len(errs) != 1 {
+		t.Fatalf("LoadConfig() errors = %v, want exactly one", errs)
+	}
+	if got, want := errs[0].Error(), "mqtt.qos (from $MQTT_QOS): must be 0, 1 or 2"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	path := writeConfig(t, minimalConfig+`redis:
+  adress: localhost:6379
+update_intervall: 60
+`)
+
+	_, errs := LoadConfig(path)
+	want := []ConfigError{
+		{Path: "redis.adress", Line: 6, Msg: "unknown setting"},
+		{Path: "update_intervall", Line: 7, Msg: "unknown setting"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("LoadConfig() errors = %v, want %v", errs, want)
+	}
+	if got := errs[0].Error(); got != "line 6: redis.adress: unknown setting" {
+		t.Errorf("error = %q", got)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,9 +39,27 @@ type DiscordAttachement struct {
 }
 
 type DiscordMessage struct {
-	Content     string               `json:"content,omitempty"`
-	Embeds      []DiscordEmbed       `json:"embeds,omitempty"`
-	Attachments []DiscordAttachement `json:"attachments,omitempty"`
+	Content         string               `json:"content,omitempty"`
+	Embeds          []DiscordEmbed       `json:"embeds,omitempty"`
+	Attachments     []DiscordAttachement `json:"attachments,omitempty"`
+	AllowedMentions *AllowedMentions     `json:"allowed_mentions,omitempty"`
+}
+
+// AllowedMentions limits who a message pings, so only the listed users are mentioned
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+	Users []string `json:"users"`
+}
+
+// mentionOnly allows pinging just the given user IDs, and never @everyone or roles
+func mentionOnly(userIDs ...string) *AllowedMentions {
+	users := []string{}
+	for _, id := range userIDs {
+		if id != "" {
+			users = append(users, id)
+		}
+	}
+	return &AllowedMentions{Parse: []string{}, Users: users}
 }
 
 type DiscordWebhookResponse struct {
@@ -47,8 +67,12 @@ type DiscordWebhookResponse struct {
 	Content      string `json:"content"`
 	Mentions     []any  `json:"mentions"`
 	MentionRoles []any  `json:"mention_roles"`
-	Attachments  []any  `json:"attachments"`
-	Embeds       []struct {
+	Attachments  []struct {
+		ID       string `json:"id"`
+		Filename string `json:"filename"`
+		URL      string `json:"url"`
+	} `json:"attachments"`
+	Embeds []struct {
 		Type   string `json:"type"`
 		URL    string `json:"url"`
 		Title  string `json:"title"`
@@ -93,6 +117,21 @@ type DiscordWebhookResponse struct {
 	WebhookID       string `json:"webhook_id"`
 }
 
+// replayWebhook, when set, gets every message instead of the webhook it was meant for, so a replay
+// can't post to the real channels. See runReplay.
+var replayWebhook string
+
+// webhookTarget returns the URL a request for webhookURL (optionally ending in /messages/<id>) goes to
+func webhookTarget(webhookURL string) string {
+	if replayWebhook == "" {
+		return webhookURL
+	}
+	if i := strings.Index(webhookURL, "/messages/"); i >= 0 {
+		return replayWebhook + webhookURL[i:]
+	}
+	return replayWebhook
+}
+
 // SendDiscordWebhook sends a DiscordMessage to the given webhook URL. If edit is true, uses PATCH instead of POST.
 // It always appends wait=true and returns the DiscordWebhookResponse.
 func SendDiscordWebhook(msg DiscordMessage, webhookURL string, edit bool) (DiscordWebhookResponse, error) {
@@ -102,7 +141,7 @@ func SendDiscordWebhook(msg DiscordMessage, webhookURL string, edit bool) (Disco
 		return respObj, fmt.Errorf("failed to marshal DiscordMessage: %w", err)
 	}
 	// Ensure ?wait=true is present
-	url := webhookURL
+	url := webhookTarget(webhookURL)
 	if len(url) > 0 && (url[len(url)-1] == '?' || url[len(url)-1] == '&') {
 		url += "wait=true"
 	} else if len(url) > 0 && (contains(url, "?")) {
@@ -134,29 +173,59 @@ func SendDiscordWebhook(msg DiscordMessage, webhookURL string, edit bool) (Disco
 	return respObj, nil
 }
 
-func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBuf *bytes.Buffer) (DiscordWebhookResponse, error) {
+// SendUpdatedWebhookWithImage edits a webhook message to the embed with the map image in it. The telemetry
+// charts, if chartBuf isn't nil, go in a second embed below it.
+func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBuf, chartBuf *bytes.Buffer) (DiscordWebhookResponse, error) {
 	// Implant the image into the embed
 	imageName := fmt.Sprintf("map_%d.png", time.Now().Unix())
-	embedImg := EmbedImage{
+	embed.Image = &EmbedImage{
 		URL: fmt.Sprintf("attachment://%s", imageName),
 	}
+	embeds := []DiscordEmbed{*embed}
+	files := []DiscordFile{
+		{Name: imageName, Description: "Map image", Data: imageBuf.Bytes()},
+	}
+	if chartBuf != nil {
+		chartName := fmt.Sprintf("charts_%d.png", time.Now().Unix())
+		embeds = append(embeds, DiscordEmbed{
+			Type:  "rich",
+			Color: embed.Color,
+			Image: &EmbedImage{URL: fmt.Sprintf("attachment://%s", chartName)},
+		})
+		files = append(files, DiscordFile{Name: chartName, Description: "Telemetry charts", Data: chartBuf.Bytes()})
+	}
+	return SendUpdatedWebhookWithFiles(webhookURL, embeds, files)
+}
 
-	embed.Image = &embedImg
+// DiscordFile is a file uploaded along with a webhook message
+type DiscordFile struct {
+	Name        string
+	Description string
+	Data        []byte
+}
+
+// SendUpdatedWebhookWithFiles edits a webhook message to the embeds, replacing its attachments with the files.
+// Files can be shown in an embed by pointing its image at attachment://<name>.
+func SendUpdatedWebhookWithFiles(webhookURL string, embeds []DiscordEmbed, files []DiscordFile) (DiscordWebhookResponse, error) {
+	return SendDiscordWebhookWithFiles(DiscordMessage{Embeds: embeds}, webhookURL, true, files)
+}
 
+// SendDiscordWebhookWithFiles is SendDiscordWebhook with files uploaded along with the message. When editing,
+// the files replace the message's previous attachments.
+func SendDiscordWebhookWithFiles(msg DiscordMessage, webhookURL string, edit bool, files []DiscordFile) (DiscordWebhookResponse, error) {
 	// We make a new attachment set to clear any previous attachments
-	attachments := []DiscordAttachement{
-		{
-			ID:          "0",
-			Filename:    imageName,
-			Description: "Map image",
-		},
+	attachments := make([]DiscordAttachement, len(files))
+	for i, file := range files {
+		attachments[i] = DiscordAttachement{
+			ID:          strconv.Itoa(i),
+			Filename:    file.Name,
+			Description: file.Description,
+		}
 	}
 
 	// Wrap up the JSON payload
-	payload := DiscordMessage{
-		Embeds:      []DiscordEmbed{*embed},
-		Attachments: attachments,
-	}
+	payload := msg
+	payload.Attachments = attachments
 
 	// Create a multipart request
 	var respObj DiscordWebhookResponse
@@ -177,12 +246,15 @@ func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBu
 		}
 	}
 
-	// Add files[0] part
-	if fw, err := w.CreateFormFile("files[0]", imageName); err != nil {
-		return respObj, fmt.Errorf("failed to create files[0] field: %w", err)
-	} else {
-		if _, err := fw.Write(imageBuf.Bytes()); err != nil {
-			return respObj, fmt.Errorf("failed to write image data: %w", err)
+	// Add a files[n] part for each file
+	for i, file := range files {
+		field := fmt.Sprintf("files[%d]", i)
+		if fw, err := w.CreateFormFile(field, file.Name); err != nil {
+			return respObj, fmt.Errorf("failed to create %s field: %w", field, err)
+		} else {
+			if _, err := fw.Write(file.Data); err != nil {
+				return respObj, fmt.Errorf("failed to write %s data: %w", file.Name, err)
+			}
 		}
 	}
 
@@ -190,7 +262,7 @@ func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBu
 		return respObj, fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	url := webhookURL
+	url := webhookTarget(webhookURL)
 	if len(url) > 0 && (url[len(url)-1] == '?' || url[len(url)-1] == '&') {
 		url += "wait=true"
 	} else if len(url) > 0 && (contains(url, "?")) {
@@ -199,7 +271,11 @@ func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBu
 		url += "?wait=true"
 	}
 
-	req, err := http.NewRequest("PATCH", url, &b)
+	method := "POST"
+	if edit {
+		method = "PATCH"
+	}
+	req, err := http.NewRequest(method, url, &b)
 	if err != nil {
 		return respObj, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -220,6 +296,82 @@ func SendUpdatedWebhookWithImage(webhookURL string, embed *DiscordEmbed, imageBu
 	return respObj, nil
 }
 
+// GetDiscordWebhookMessage fetches a message previously sent by the webhook. webhookURL must include /messages/<id>.
+func GetDiscordWebhookMessage(webhookURL string) (DiscordWebhookResponse, error) {
+	var respObj DiscordWebhookResponse
+	resp, err := http.Get(webhookTarget(webhookURL))
+	if err != nil {
+		return respObj, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respObj, fmt.Errorf("discord webhook returned status: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respObj); err != nil {
+		return respObj, fmt.Errorf("failed to decode DiscordWebhookResponse: %w", err)
+	}
+	return respObj, nil
+}
+
+// UpdateEmbedPhase changes the title and color of an existing message's embed, leaving its fields and image alone.
+// Used when a phase changes without a new packet to build a full update from (e.g. lost signal).
+func UpdateEmbedPhase(webhookURL string, title string, color int) error {
+	existing, err := GetDiscordWebhookMessage(webhookURL)
+	if err != nil {
+		return err
+	}
+	if len(existing.Embeds) == 0 {
+		return fmt.Errorf("message has no embeds to update")
+	}
+	// Every embed is sent back, or the ones after the first (the telemetry charts) would be dropped
+	var embeds []DiscordEmbed
+	for i, old := range existing.Embeds {
+		embed := DiscordEmbed{
+			Type:  old.Type,
+			Title: old.Title,
+			Color: color,
+			Url:   old.URL,
+		}
+		if i == 0 {
+			embed.Title = title
+		}
+		for _, f := range old.Fields {
+			embed.Fields = append(embed.Fields, DiscordField{Name: f.Name, Value: f.Value})
+		}
+		if old.Image.URL != "" {
+			embed.Image = &EmbedImage{URL: existing.attachmentRef(old.Image.URL)}
+		}
+		embeds = append(embeds, embed)
+	}
+	// Listing the attachments keeps them, any left out would be deleted
+	msg := DiscordMessage{Embeds: embeds}
+	for _, a := range existing.Attachments {
+		msg.Attachments = append(msg.Attachments, DiscordAttachement{ID: a.ID})
+	}
+	_, err = SendDiscordWebhook(msg, webhookURL, true)
+	return err
+}
+
+// attachmentRef turns the URL of one of the message's attachments back into attachment://<name>. Discord
+// hands out signed CDN URLs that expire, an edited embed has to keep pointing at the file itself.
+func (r DiscordWebhookResponse) attachmentRef(imageURL string) string {
+	path, _, _ := strings.Cut(imageURL, "?")
+	for _, a := range r.Attachments {
+		if strings.HasSuffix(path, "/"+a.Filename) {
+			return "attachment://" + a.Filename
+		}
+	}
+	return imageURL
+}
+
+// webhookBaseURL strips the /messages/<id> suffix from a message URL, giving the webhook URL to post new messages to
+func webhookBaseURL(messageURL string) string {
+	if idx := strings.LastIndex(messageURL, "/messages/"); idx >= 0 {
+		return messageURL[:idx]
+	}
+	return messageURL
+}
+
 // contains returns true if substr is in s
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || (len(s) > len(substr) && (s[:len(substr)] == substr || contains(s[1:], substr))))
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Geohash length used for the cache key of driving origins and destinations, about 1.2 km across
+const drivingCachePrecision = 6
+
+// DrivingConfig configures driving distance/time estimates to the (predicted) landing point
+type DrivingConfig struct {
+	Enabled bool `yaml:"enabled" env:"DRIVING_ESTIMATES"`
+	// How many of the nearest receivers to estimate from
+	Receivers int `yaml:"receivers" env:"DRIVING_RECEIVERS"`
+	// Origins further than this in a straight line are skipped
+	MaxMiles float64 `yaml:"max_miles" env:"DRIVING_MAX_MILES"`
+	// Radar distance requests allowed per UTC day, shared by every instance
+	MaxRequestsPerDay int64 `yaml:"max_requests_per_day" env:"DRIVING_MAX_REQUESTS_PER_DAY"`
+	// Seconds an estimate is cached
+	CacheTTL int64 `yaml:"cache_ttl" env:"DRIVING_CACHE_TTL"`
+}
+
+// DriveEstimate is a driving distance and time between two points
+type DriveEstimate struct {
+	DistanceText string  `json:"distance"` // e.g. "23.4 mi"
+	Minutes      float64 `json:"minutes"`
+}
+
+// errDrivingBudget is returned once the daily Radar request budget is used up
+var errDrivingBudget = errors.New("daily driving estimate budget used up")
+
+// DrivingEstimate returns the driving distance and time between two points, from the cache when possible
+func DrivingEstimate(fromLat, fromLon, toLat, toLon float64) (DriveEstimate, error) {
+	var est DriveEstimate
+	cfg := currentConfig().Driving
+	ctx := context.Background()
+	key := fmt.Sprintf("balloony:drive:%s:%s", Geohash(fromLat, fromLon, drivingCachePrecision), Geohash(toLat, toLon, drivingCachePrecision))
+
+	data, err := redisclient.GetRaw(ctx, key)
+	if err != nil {
+		fmt.Println("Error reading driving estimate cache:", err)
+	}
+	if data != nil && json.Unmarshal(data, &est) == nil {
+		return est, nil
+	}
+
+	// The budget is counted per UTC day, so the free tier isn't used up by one busy launch
+	budgetKey := "balloony:drive:requests:" + clock.Now().UTC().Format("2006-01-02")
+	count, err := redisclient.IncrDailyCounter(ctx, budgetKey)
+	if err != nil {
+		return est, err
+	}
+	if count > cfg.MaxRequestsPerDay {
+		return est, errDrivingBudget
+	}
+
+	resp, err := RadarDistanceCalc([]float64{fromLat, fromLon}, []float64{toLat, toLon})
+	if err != nil {
+		return est, err
+	}
+	if resp.Routes.Car.Distance.Text == "" {
+		return est, errors.New("no driving route found")
+	}
+	est = DriveEstimate{
+		DistanceText: resp.Routes.Car.Distance.Text,
+		Minutes:      resp.Routes.Car.Duration.Value,
+	}
+	if data, err := json.Marshal(est); err == nil {
+		if err := redisclient.SetRawTTL(ctx, key, data, time.Duration(cfg.CacheTTL)*time.Second); err != nil {
+			fmt.Println("Error writing driving estimate cache:", err)
+		}
+	}
+	return est, nil
+}
+
+// drivingField builds an embed field with driving estimates from the nearest receivers and every chase team
+// member within range to the point, ok is false if there is nothing to show
+func drivingField(title string, lat, lon float64) (DiscordField, bool) {
+	cfg := currentConfig().Driving
+	if !cfg.Enabled {
+		return DiscordField{}, false
+	}
+
+	receiversMutex.RLock()
+	origins := nearestPoints(lat, lon, receivers, cfg.Receivers, cfg.MaxMiles)
+	receiversMutex.RUnlock()
+	members, err := redisclient.ChaseMembers()
+	if err != nil {
+		fmt.Println("Error loading chase team:", err)
+	}
+	for _, m := range members {
+		if haversineMiles(lat, lon, m.Lat, m.Lon) <= min(m.MaxMiles, cfg.MaxMiles) {
+			origins = append(origins, Point{Lat: m.Lat, Lon: m.Lon, Name: m.Name})
+		}
+	}
+
+	var lines []string
+	for _, origin := range origins {
+		est, err := DrivingEstimate(origin.Lat, origin.Lon, lat, lon)
+		if err != nil {
+			fmt.Printf("Error getting driving estimate from %s: %v\n", origin.Name, err)
+			if errors.Is(err, errDrivingBudget) {
+				break
+			}
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("**%s**: %s, %s", origin.Name, est.DistanceText, formatDuration(time.Duration(est.Minutes*float64(time.Minute)))))
+	}
+	if len(lines) == 0 {
+		return DiscordField{}, false
+	}
+	return DiscordField{Name: title, Value: strings.Join(lines, "\n")}, true
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// ExportConfig configures which flight exports are attached to the landing summary
+type ExportConfig struct {
+	Attach []string `yaml:"attach" env:"EXPORT_ATTACH"`
+}
+
+// exportFormats are the supported export formats, keyed by file extension
+var exportFormats = map[string]func(serial string, history []HistoryEntry, pred *SHPredictionResult) ([]byte, error){
+	"gpx": ExportGPX,
+	"kml": ExportKML,
+	"csv": ExportCSV,
+}
+
+// ExportFlight exports a sonde's stored history and its latest prediction (which may be nil) in the given format
+func ExportFlight(format, serial string, history []HistoryEntry, pred *SHPredictionResult) ([]byte, error) {
+	export, ok := exportFormats[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("no history stored for %s", serial)
+	}
+	return export(serial, history, pred)
+}
+
+// ExportGPX exports the flown track, the predicted path as a second track and the landing as a waypoint
+func ExportGPX(serial string, history []HistoryEntry, pred *SHPredictionResult) ([]byte, error) {
+	doc := &gpx.GPX{
+		Version: "1.1",
+		Creator: "balloony",
+		Name:    serial,
+	}
+
+	var flown gpx.GPXTrackSegment
+	for _, h := range history {
+		flown.Points = append(flown.Points, gpxPoint(h.Packet.Lat, h.Packet.Lon, h.Packet.Alt, time.Unix(h.Time, 0).UTC()))
+	}
+	doc.Tracks = append(doc.Tracks, gpx.GPXTrack{Name: serial + " flown", Segments: []gpx.GPXTrackSegment{flown}})
+
+	last := history[len(history)-1].Packet
+	lastPoint := gpxPoint(last.Lat, last.Lon, last.Alt, time.Unix(history[len(history)-1].Time, 0).UTC())
+	lastPoint.Name = serial + " last position"
+	doc.Waypoints = append(doc.Waypoints, lastPoint)
+
+	if pred != nil && len(pred.Path) > 0 {
+		var predicted gpx.GPXTrackSegment
+		for _, pt := range pred.Path {
+			predicted.Points = append(predicted.Points, gpxPoint(pt.Lat, pt.Lon, pt.Alt, time.Unix(int64(pt.Time), 0).UTC()))
+		}
+		doc.Tracks = append(doc.Tracks, gpx.GPXTrack{Name: serial + " predicted", Segments: []gpx.GPXTrackSegment{predicted}})
+
+		landing := gpxPoint(pred.Latitude, pred.Longitude, pred.Altitude, pred.Time)
+		landing.Name = serial + " predicted landing"
+		doc.Waypoints = append(doc.Waypoints, landing)
+	}
+	return doc.ToXml(gpx.ToXmlParams{Version: "1.1", Indent: true})
+}
+
+func gpxPoint(lat, lon, alt float64, t time.Time) gpx.GPXPoint {
+	return gpx.GPXPoint{
+		Point: gpx.Point{
+			Latitude:  lat,
+			Longitude: lon,
+			Elevation: *gpx.NewNullableFloat64(alt),
+		},
+		Timestamp: t,
+	}
+}
+
+// KML document, only the parts we write
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Namespace  string         `xml:"xmlns,attr"`
+	Name       string         `xml:"Document>name"`
+	Styles     []kmlStyle     `xml:"Document>Style"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlStyle struct {
+	ID        string `xml:"id,attr"`
+	LineColor string `xml:"LineStyle>color"`
+	LineWidth int    `xml:"LineStyle>width"`
+	PolyColor string `xml:"PolyStyle>color"`
+}
+
+type kmlPlacemark struct {
+	Name       string         `xml:"name"`
+	StyleURL   string         `xml:"styleUrl,omitempty"`
+	LineString *kmlLineString `xml:"LineString,omitempty"`
+	Point      *kmlPoint      `xml:"Point,omitempty"`
+}
+
+type kmlLineString struct {
+	Extrude      int    `xml:"extrude"`
+	Tessellate   int    `xml:"tessellate"`
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type kmlPoint struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// ExportKML exports the flown track and predicted path at their real altitudes, extruded to the ground,
+// with the last position and the predicted landing as points
+func ExportKML(serial string, history []HistoryEntry, pred *SHPredictionResult) ([]byte, error) {
+	doc := kmlDocument{
+		Namespace: "http://www.opengis.net/kml/2.2",
+		Name:      serial,
+		// KML colors are aabbggrr
+		Styles: []kmlStyle{
+			{ID: "flown", LineColor: "ff00d7ff", LineWidth: 3, PolyColor: "4000d7ff"},
+			{ID: "predicted", LineColor: "ff0000ff", LineWidth: 3, PolyColor: "400000ff"},
+		},
+	}
+
+	var coords []string
+	for _, h := range history {
+		coords = append(coords, kmlCoordinate(h.Packet.Lat, h.Packet.Lon, h.Packet.Alt))
+	}
+	doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+		Name:       serial + " flown",
+		StyleURL:   "#flown",
+		LineString: &kmlLineString{Extrude: 1, Tessellate: 1, AltitudeMode: "absolute", Coordinates: strings.Join(coords, " ")},
+	})
+	last := history[len(history)-1].Packet
+	doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+		Name:  serial + " last position",
+		Point: &kmlPoint{AltitudeMode: "absolute", Coordinates: kmlCoordinate(last.Lat, last.Lon, last.Alt)},
+	})
+
+	if pred != nil && len(pred.Path) > 0 {
+		coords = coords[:0]
+		for _, pt := range pred.Path {
+			coords = append(coords, kmlCoordinate(pt.Lat, pt.Lon, pt.Alt))
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:       serial + " predicted",
+			StyleURL:   "#predicted",
+			LineString: &kmlLineString{Extrude: 1, Tessellate: 1, AltitudeMode: "absolute", Coordinates: strings.Join(coords, " ")},
+		})
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name: serial + " predicted landing",
+			// The ground height at the predicted landing isn't known, so it is drawn on the terrain
+			Point: &kmlPoint{AltitudeMode: "clampToGround", Coordinates: kmlCoordinate(pred.Latitude, pred.Longitude, 0)},
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func kmlCoordinate(lat, lon, alt float64) string {
+	return fmt.Sprintf("%.6f,%.6f,%.0f", lon, lat, alt)
+}
+
+// ExportCSV exports every stored packet with all of its telemetry fields, one row per packet
+func ExportCSV(serial string, history []HistoryEntry, pred *SHPredictionResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	// The columns are the SHPacket JSON field names, after the time we received the packet
+	t := reflect.TypeOf(SHPacket{})
+	header := []string{"received"}
+	for i := 0; i < t.NumField(); i++ {
+		header = append(header, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, h := range history {
+		row := []string{time.Unix(h.Time, 0).UTC().Format(time.RFC3339)}
+		v := reflect.ValueOf(h.Packet)
+		for i := 0; i < v.NumField(); i++ {
+			row = append(row, csvValue(v.Field(i).Interface()))
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// exportAttachments builds the configured export files for the landing summary
+func exportAttachments(serial string, history []HistoryEntry, pred *SHPredictionResult) []DiscordFile {
+	var files []DiscordFile
+	for _, format := range currentConfig().Export.Attach {
+		data, err := ExportFlight(format, serial, history, pred)
+		if err != nil {
+			fmt.Printf("Error exporting %s as %s: %v\n", serial, format, err)
+			continue
+		}
+		files = append(files, DiscordFile{
+			Name:        fmt.Sprintf("%s.%s", serial, strings.ToLower(format)),
+			Description: fmt.Sprintf("Flight track (%s)", strings.ToUpper(format)),
+			Data:        data,
+		})
+	}
+	return files
+}
+
+// runExportCommand writes a sonde's stored history and latest prediction to a file
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "gpx", "export format: gpx, kml or csv")
+	output := fs.String("o", "", "output file, - for stdout (default <serial>.<format>)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: balloony export [-format gpx|kml|csv] [-o file] <serial>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a serial is required")
+	}
+	serial := fs.Arg(0)
+
+	history, err := LoadHistory(serial)
+	if err != nil {
+		return err
+	}
+	// The prediction is optional, finished flights won't have one any more
+	pred, err := GetPrediction(serial)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "No prediction included:", err)
+		pred = nil
+	}
+	data, err := ExportFlight(*format, serial, history, pred)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "-":
+		_, err = os.Stdout.Write(data)
+		return err
+	case "":
+		*output = fmt.Sprintf("%s.%s", serial, strings.ToLower(*format))
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d points to %s\n", len(history), *output)
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// FlightPhase is where a sonde is in its flight, persisted in the SondeSession
+type FlightPhase string
+
+const (
+	PhaseLaunch  FlightPhase = "launch"
+	PhaseAscent  FlightPhase = "ascent"
+	PhaseBurst   FlightPhase = "burst"
+	PhaseDescent FlightPhase = "descent"
+	PhaseLanded  FlightPhase = "landed"
+	PhaseLost    FlightPhase = "lost"
+)
+
+const (
+	// Consecutive descending frames (well below the peak) needed before we call a burst
+	burstConfirmFrames = 3
+	// How far below the peak altitude (m) the sonde must be before we call a burst
+	burstAltitudeDrop = 100
+	// Consecutive near-still frames needed before we call a landing
+	landedConfirmFrames = 3
+	// Vertical speeds (m/s) below this are treated as stationary
+	landedMaxVelV = 0.5
+	// iMet sondes don't report a vertical speed, altitude changes (m) between packets up to this are
+	// treated as stationary
+	iMetStillMeters = 2
+	// Sondes are only considered landed below this altitude (10,000 ft in meters)
+	lowAltitudeMeters = 3048
+	// Default time without packets before a sonde is considered lost (or landed, if it was low)
+	defaultLostSignalTimeout = 15 * 60
+)
+
+// PhaseStyle is how a phase is presented in the Discord embed
+type PhaseStyle struct {
+	Icon  string
+	Title string
+	Color int
+}
+
+var phaseStyles = map[FlightPhase]PhaseStyle{
+	PhaseLaunch:  {Icon: "\U0001F388", Title: "is airborne", Color: 0x00FFFF},
+	PhaseAscent:  {Icon: "\U0001F388", Title: "is airborne", Color: 0x00FFFF},
+	PhaseBurst:   {Icon: "\U0001F4A5", Title: "has burst", Color: 0xFF8C00},
+	PhaseDescent: {Icon: "\U0001FA82", Title: "is descending", Color: 0xFFD700},
+	PhaseLanded:  {Icon: "\U0001F4CD", Title: "has landed", Color: 0x2ECC71},
+	PhaseLost:    {Icon: "\U0001F4E1", Title: "signal lost", Color: 0x95A5A6},
+}
+
+// Style returns the embed style for the phase, unknown phases (e.g. old sessions) look like launch
+func (p FlightPhase) Style() PhaseStyle {
+	if style, ok := phaseStyles[p]; ok {
+		return style
+	}
+	return phaseStyles[PhaseLaunch]
+}
+
+// Terminal returns true if no more packets are expected
+func (p FlightPhase) Terminal() bool {
+	return p == PhaseLanded || p == PhaseLost
+}
+
+// EmbedTitle builds the embed title for a sonde in this phase
+func (p FlightPhase) EmbedTitle(sondeType, serial string) string {
+	style := p.Style()
+	return fmt.Sprintf("%s %s %s %s", style.Icon, sondeType, serial, style.Title)
+}
+
+// setPhase moves the session to a new phase
+func (s *SondeSession) setPhase(phase FlightPhase, now int64) {
+	s.Phase = phase
+	s.PhaseTime = now
+	s.DescentFrames = 0
+	s.StillFrames = 0
+}
+
+// UpdatePhase feeds a packet into the session's phase tracker and returns true if the phase changed
+func (s *SondeSession) UpdatePhase(pkt SHPacket, now int64) bool {
+	prev := s.Phase
+	if s.Phase == "" {
+		s.setPhase(PhaseLaunch, now)
+	}
+
+	// Ignore repeated frames (multiple receivers uploading the same frame), they say nothing new
+	if pkt.Frame != 0 && pkt.Frame == s.LastFrame && s.LastSeen != 0 {
+		return false
+	}
+
+	s.LastSeen = now
+	s.LastFrame = pkt.Frame
+	s.LastLat = pkt.Lat
+	s.LastLon = pkt.Lon
+	s.LastAlt = pkt.Alt
+	if pkt.Alt > s.MaxAlt {
+		s.MaxAlt = pkt.Alt
+		s.MaxAltLat = pkt.Lat
+		s.MaxAltLon = pkt.Lon
+		s.MaxAltTime = now
+	}
+
+	if pkt.VelV < 0 {
+		s.DescentFrames++
+	} else {
+		s.DescentFrames = 0
+	}
+	if math.Abs(pkt.VelV) < landedMaxVelV {
+		s.StillFrames++
+	} else {
+		s.StillFrames = 0
+	}
+
+	switch s.Phase {
+	case PhaseLaunch:
+		if pkt.VelV > 0 {
+			s.setPhase(PhaseAscent, now)
+		} else if s.DescentFrames >= burstConfirmFrames {
+			// First heard after burst (e.g. it drifted into range), so we missed the ascent
+			s.setPhase(PhaseDescent, now)
+		}
+	case PhaseAscent:
+		if s.DescentFrames >= burstConfirmFrames && pkt.Alt < s.MaxAlt-burstAltitudeDrop {
+			s.setPhase(PhaseBurst, now)
+		}
+	case PhaseBurst:
+		// Burst is only held for one update so it can be announced
+		s.setPhase(PhaseDescent, now)
+	case PhaseDescent:
+		if s.StillFrames >= landedConfirmFrames && pkt.Alt < lowAltitudeMeters {
+			s.setPhase(PhaseLanded, now)
+		}
+	case PhaseLost:
+		// We heard it again, pick up where it is now
+		if pkt.VelV < 0 || s.MaxAlt-pkt.Alt > burstAltitudeDrop {
+			s.setPhase(PhaseDescent, now)
+		} else {
+			s.setPhase(PhaseAscent, now)
+		}
+	}
+	return s.Phase != prev
+}
+
+// CheckSignal is called periodically for sondes we haven't heard from, returns true if the phase changed.
+// A sonde that goes quiet while low and descending has almost certainly landed out of receiver range.
+func (s *SondeSession) CheckSignal(now, timeout int64) bool {
+	if s.Phase.Terminal() || s.LastSeen == 0 || now-s.LastSeen < timeout {
+		return false
+	}
+	if (s.Phase == PhaseDescent || s.Phase == PhaseBurst) && s.LastAlt < lowAltitudeMeters {
+		s.setPhase(PhaseLanded, now)
+	} else {
+		s.setPhase(PhaseLost, now)
+	}
+	return true
+}
+
+// iMetVelV stands in for the vertical speed iMet sondes don't report: -1 if the altitude dropped since
+// the last packet, 1 if it rose, and 0 if it barely moved (most likely on the ground), so the landing
+// can be detected
+func iMetVelV(prevAlt int, alt float64) float64 {
+	change := int(alt) - prevAlt
+	switch {
+	case change < -iMetStillMeters:
+		return -1
+	case change > iMetStillMeters:
+		return 1
+	}
+	return 0
+}
+
+// touchActiveSonde marks an active sonde outside every region as heard from, so it isn't taken for lost
+// (or landed) while it is still transmitting
+func touchActiveSonde(pkt SHPacket) {
+	active, err := redisclient.IsActiveSonde(pkt.Serial)
+	if err != nil {
+		fmt.Println("Error checking active sonde:", err)
+		return
+	}
+	if !active || !claimSonde(pkt.Serial) {
+		return
+	}
+	defer releaseSonde(pkt.Serial)
+	session, err := redisclient.GetSondeSession(pkt.Serial)
+	if err != nil {
+		fmt.Println("Error getting SondeSession from Redis:", err)
+		return
+	}
+	if session == nil {
+		return
+	}
+	session.LastSeen = clock.Now().UTC().Unix()
+	if err := redisclient.SaveSondeSession(pkt.Serial, session); err != nil {
+		fmt.Println("Error saving SondeSession to Redis:", err)
+	}
+}
+
+// checkStaleSessions looks for active sondes that stopped transmitting and updates their phase and embed
+func checkStaleSessions() {
+	serials, err := redisclient.ActiveSondes()
+	if err != nil {
+		fmt.Println("Error listing active sondes:", err)
+		return
+	}
+	now := clock.Now().UTC().Unix()
+	timeout := currentConfig().LostSignalTimeout
+	for _, serial := range serials {
+		if !claimSonde(serial) {
+			// Currently being processed, so it clearly isn't stale
+			continue
+		}
+		checkStaleSession(serial, now, timeout)
+		releaseSonde(serial)
+	}
+}
+
+func checkStaleSession(serial string, now, timeout int64) {
+	session, err := redisclient.GetSondeSession(serial)
+	if err != nil {
+		fmt.Println("Error getting SondeSession from Redis:", err)
+		return
+	}
+	if session == nil {
+		// Session expired, nothing left to track
+		redisclient.UntrackActiveSonde(serial)
+		return
+	}
+	if !session.CheckSignal(now, timeout) {
+		return
+	}
+	fmt.Printf("%s phase changed to %s (no packets for %ds)\n", serial, session.Phase, now-session.LastSeen)
+
+	if session.Phase == PhaseLanded {
+		sendLandingSummary(serial, session)
+	} else {
+		for name, msg := range session.Regions {
+			if err := UpdateEmbedPhase(msg.Webhook, session.Phase.EmbedTitle(session.SondeType, serial), session.Phase.Style().Color); err != nil {
+				fmt.Printf("Error updating Discord message phase in %s: %v\n", name, err)
+			}
+		}
+	}
+	if session.Phase.Terminal() {
+		redisclient.UntrackActiveSonde(serial)
+	}
+	if err := redisclient.SaveSondeSession(serial, session); err != nil {
+		fmt.Println("Error saving SondeSession to Redis:", err)
+	}
+}
+
+// startPhaseSweeper periodically checks for sondes that went quiet
+func startPhaseSweeper() {
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			checkStaleSessions()
+		}
+	}()
+}
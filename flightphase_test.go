@@ -0,0 +1,188 @@
+package main
+
+import "testing"
+
+// phaseStep is one packet fed to the phase tracker, and the phase expected after it
+type phaseStep struct {
+	frame int
+	alt   float64
+	velV  float64
+	want  FlightPhase
+}
+
+func TestUpdatePhase(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []phaseStep
+	}{
+		{
+			name: "ascent",
+			steps: []phaseStep{
+				{1, 300, 0, PhaseLaunch},
+				{2, 320, 5, PhaseAscent},
+				{3, 5000, 5, PhaseAscent},
+			},
+		},
+		{
+			name: "burst then descent",
+			steps: []phaseStep{
+				{1, 20000, 5, PhaseAscent},
+				{2, 30000, 5, PhaseAscent},
+				{3, 29800, -20, PhaseAscent},
+				{4, 29600, -20, PhaseAscent},
+				{5, 29400, -20, PhaseBurst},
+				// Burst is only held for one packet
+				{6, 29200, -20, PhaseDescent},
+			},
+		},
+		{
+			name: "no burst while still near the peak",
+			steps: []phaseStep{
+				{1, 30000, 5, PhaseAscent},
+				{2, 29980, -1, PhaseAscent},
+				{3, 29960, -1, PhaseAscent},
+				{4, 29950, -1, PhaseAscent},
+			},
+		},
+		{
+			name: "repeated frames don't count",
+			steps: []phaseStep{
+				{1, 30000, 5, PhaseAscent},
+				{2, 29800, -20, PhaseAscent},
+				{2, 29800, -20, PhaseAscent},
+				{2, 29800, -20, PhaseAscent},
+				{3, 29600, -20, PhaseAscent},
+				{4, 29400, -20, PhaseBurst},
+			},
+		},
+		{
+			name: "missed ascent",
+			steps: []phaseStep{
+				{1, 12000, -10, PhaseLaunch},
+				{2, 11900, -10, PhaseLaunch},
+				{3, 11800, -10, PhaseDescent},
+			},
+		},
+		{
+			name: "landed",
+			steps: []phaseStep{
+				{1, 3000, -10, PhaseLaunch},
+				{2, 2000, -10, PhaseLaunch},
+				{3, 1000, -10, PhaseDescent},
+				{4, 300, 0, PhaseDescent},
+				{5, 300, 0.2, PhaseDescent},
+				{6, 300, 0, PhaseLanded},
+			},
+		},
+		{
+			name: "not landed while still high up",
+			steps: []phaseStep{
+				{1, 12000, -10, PhaseLaunch},
+				{2, 11900, -10, PhaseLaunch},
+				{3, 11800, -10, PhaseDescent},
+				{4, 11800, 0, PhaseDescent},
+				{5, 11800, 0, PhaseDescent},
+				{6, 11800, 0, PhaseDescent},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SondeSession{}
+			now := int64(1000)
+			for i, step := range tt.steps {
+				now += 10
+				s.UpdatePhase(SHPacket{Frame: step.frame, Alt: step.alt, VelV: step.velV}, now)
+				if s.Phase != step.want {
+					t.Fatalf("after packet %d: phase %s, want %s", i+1, s.Phase, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatePhaseReportsChanges(t *testing.T) {
+	s := &SondeSession{}
+	if !s.UpdatePhase(SHPacket{Frame: 1, Alt: 300, VelV: 5}, 10) {
+		t.Error("launch to ascent wasn't reported as a change")
+	}
+	if s.UpdatePhase(SHPacket{Frame: 2, Alt: 350, VelV: 5}, 20) {
+		t.Error("ascent to ascent was reported as a change")
+	}
+}
+
+func TestCheckSignal(t *testing.T) {
+	const timeout = 900
+	tests := []struct {
+		name    string
+		phase   FlightPhase
+		lastAlt float64
+		quiet   int64 // Seconds since the last packet
+		want    FlightPhase
+		changed bool
+	}{
+		{"still heard from", PhaseAscent, 20000, timeout - 1, PhaseAscent, false},
+		{"lost while high", PhaseAscent, 20000, timeout, PhaseLost, true},
+		{"lost while descending high", PhaseDescent, 5000, timeout, PhaseLost, true},
+		{"landed out of range", PhaseDescent, 1000, timeout, PhaseLanded, true},
+		{"landed out of range right after burst", PhaseBurst, 1000, timeout, PhaseLanded, true},
+		{"lost low on the way up", PhaseAscent, 1000, timeout, PhaseLost, true},
+		{"already landed", PhaseLanded, 300, timeout * 10, PhaseLanded, false},
+		{"already lost", PhaseLost, 20000, timeout * 10, PhaseLost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SondeSession{Phase: tt.phase, LastSeen: 1000, LastAlt: tt.lastAlt}
+			changed := s.CheckSignal(1000+tt.quiet, timeout)
+			if changed != tt.changed || s.Phase != tt.want {
+				t.Errorf("CheckSignal() = %v with phase %s, want %v with phase %s", changed, s.Phase, tt.changed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLostSignalResumes(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  SHPacket
+		want FlightPhase
+	}{
+		{"falling", SHPacket{Frame: 100, Alt: 15000, VelV: -15}, PhaseDescent},
+		{"well below the peak", SHPacket{Frame: 100, Alt: 15000, VelV: 0}, PhaseDescent},
+		{"still climbing", SHPacket{Frame: 100, Alt: 25000, VelV: 5}, PhaseAscent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SondeSession{}
+			s.UpdatePhase(SHPacket{Frame: 1, Alt: 20000, VelV: 5}, 10)
+			s.UpdatePhase(SHPacket{Frame: 2, Alt: 25000, VelV: 5}, 20)
+			if !s.CheckSignal(2000, 900) || s.Phase != PhaseLost {
+				t.Fatalf("phase %s after going quiet, want %s", s.Phase, PhaseLost)
+			}
+			if !s.UpdatePhase(tt.pkt, 2010) || s.Phase != tt.want {
+				t.Errorf("phase %s after hearing it again, want %s", s.Phase, tt.want)
+			}
+		})
+	}
+}
+
+func TestIMetVelV(t *testing.T) {
+	tests := []struct {
+		prevAlt int
+		alt     float64
+		want    float64
+	}{
+		{1000, 1100, 1},
+		{1000, 900, -1},
+		{1000, 1000, 0},
+		{1000, 1002, 0},
+		{1000, 998, 0},
+		{1000, 1003, 1},
+		{1000, 997, -1},
+	}
+	for _, tt := range tests {
+		if got := iMetVelV(tt.prevAlt, tt.alt); got != tt.want {
+			t.Errorf("iMetVelV(%d, %v) = %v, want %v", tt.prevAlt, tt.alt, got, tt.want)
+		}
+	}
+}
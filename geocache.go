@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Redis hash holding the geocode cache hit/miss counters
+const geocodeStatsKey = "balloony:geocode:stats"
+
+// GeocodeCacheConfig configures the Redis cache in front of the geocoders
+type GeocodeCacheConfig struct {
+	Enabled bool `yaml:"enabled" env:"GEOCODE_CACHE"`
+	// Geohash length the cache is keyed by, 7 is about 150 m across
+	Precision int `yaml:"precision" env:"GEOCODE_CACHE_PRECISION"`
+	// Seconds a cached place is kept
+	TTL int64 `yaml:"ttl" env:"GEOCODE_CACHE_TTL"`
+}
+
+// CachedGeocoder caches another Geocoder's places in Redis, keyed by the geohash of the position.
+// The cache is shared by every sonde and every instance using the same Redis.
+type CachedGeocoder struct {
+	next      Geocoder
+	prefix    string
+	precision int
+	ttl       time.Duration
+}
+
+// NewCachedGeocoder wraps next, language is part of the key since it changes the names returned
+func NewCachedGeocoder(next Geocoder, cfg GeocodeCacheConfig, language string) *CachedGeocoder {
+	return &CachedGeocoder{
+		next:      next,
+		prefix:    fmt.Sprintf("balloony:geocode:%s:%s:", next.Name(), language),
+		precision: cfg.Precision,
+		ttl:       time.Duration(cfg.TTL) * time.Second,
+	}
+}
+
+func (g *CachedGeocoder) Name() string {
+	return g.next.Name()
+}
+
+func (g *CachedGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	// Subcommands like config validate never connect to Redis
+	if redisclient == nil {
+		return g.next.ReverseGeocode(lat, lon)
+	}
+	ctx := context.Background()
+	key := g.prefix + Geohash(lat, lon, g.precision)
+
+	data, err := redisclient.GetRaw(ctx, key)
+	if err != nil {
+		fmt.Println("Error reading geocode cache:", err)
+	}
+	if data != nil {
+		var place Place
+		if err := json.Unmarshal(data, &place); err == nil {
+			redisclient.IncrStat(ctx, geocodeStatsKey, "hits")
+			return place, nil
+		}
+	}
+	redisclient.IncrStat(ctx, geocodeStatsKey, "misses")
+
+	place, err := g.next.ReverseGeocode(lat, lon)
+	if err != nil {
+		// Failures aren't cached, the next lookup tries again
+		return place, err
+	}
+	if data, err := json.Marshal(place); err == nil {
+		if err := redisclient.SetRawTTL(ctx, key, data, g.ttl); err != nil {
+			fmt.Println("Error writing geocode cache:", err)
+		}
+	}
+	return place, nil
+}
+
+// runGeocodeCommand implements `balloony geocode stats` and `balloony geocode <lat> <lon>`
+func runGeocodeCommand(args []string) error {
+	if len(args) == 1 && args[0] == "stats" {
+		stats, err := redisclient.GetStats(context.Background(), geocodeStatsKey)
+		if err != nil {
+			return err
+		}
+		hits, _ := strconv.ParseInt(stats["hits"], 10, 64)
+		misses, _ := strconv.ParseInt(stats["misses"], 10, 64)
+		ratio := 0.0
+		if hits+misses > 0 {
+			ratio = float64(hits) / float64(hits+misses) * 100
+		}
+		fmt.Printf("Geocode cache: %d hits, %d misses (%.1f%% hit rate)\n", hits, misses, ratio)
+		return nil
+	}
+	if len(args) == 2 {
+		lat, err1 := strconv.ParseFloat(args[0], 64)
+		lon, err2 := strconv.ParseFloat(args[1], 64)
+		if err1 == nil && err2 == nil {
+			place, err := ReverseGeocode(lat, lon)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s (%+v)\n", place, place)
+			return nil
+		}
+	}
+	return fmt.Errorf("usage: balloony geocode stats | balloony geocode <lat> <lon>")
+}
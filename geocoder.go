@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Place is a reverse geocoded location, independent of the backend that found it
+type Place struct {
+	City        string
+	County      string
+	State       string
+	StateCode   string
+	Country     string
+	CountryCode string
+}
+
+// Default place formats, keyed by country code. The US keeps the original City, ST / <County> County, ST style.
+var defaultPlaceFormats = map[string]string{
+	"default": `{{join ", " (or .City .County) .State .Country}}`,
+	"US":      `{{join ", " (or .City (suffix .County " County")) .StateCode}}`,
+}
+
+var placeFormatFuncs = template.FuncMap{
+	// join joins the non-empty values, so missing parts don't leave stray separators.
+	// Repeats are dropped too, e.g. a city state like Hamburg, Hamburg.
+	"join": func(sep string, values ...string) string {
+		var parts []string
+		for _, v := range values {
+			if v != "" && (len(parts) == 0 || parts[len(parts)-1] != v) {
+				parts = append(parts, v)
+			}
+		}
+		return strings.Join(parts, sep)
+	},
+	// suffix appends suf to s, unless s is empty
+	"suffix": func(s, suf string) string {
+		if s == "" {
+			return ""
+		}
+		return s + suf
+	},
+}
+
+// parsePlaceFormats compiles the place format templates, keyed by upper case country code
+func parsePlaceFormats(formats map[string]string) (map[string]*template.Template, error) {
+	parsed := make(map[string]*template.Template, len(formats))
+	for key, format := range formats {
+		tmpl, err := template.New(key).Funcs(placeFormatFuncs).Option("missingkey=zero").Parse(format)
+		if err != nil {
+			return nil, err
+		}
+		if key != "default" {
+			key = strings.ToUpper(key)
+		}
+		parsed[key] = tmpl
+	}
+	if _, ok := parsed["default"]; !ok {
+		return nil, errors.New("a default format is required")
+	}
+	return parsed, nil
+}
+
+// Format renders the place with the template for its country, or the default one
+func (p Place) Format(formats map[string]*template.Template) string {
+	tmpl, ok := formats[p.CountryCode]
+	if !ok {
+		tmpl = formats["default"]
+	}
+	var sb strings.Builder
+	if tmpl == nil || tmpl.Execute(&sb, p) != nil || strings.TrimSpace(sb.String()) == "" {
+		return "Location not found"
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// String formats the place with the configured place formats
+func (p Place) String() string {
+	return p.Format(currentConfig().placeFormats)
+}
+
+// Geocoder turns a position into a Place
+type Geocoder interface {
+	Name() string
+	ReverseGeocode(lat, lon float64) (Place, error)
+}
+
+// FallbackGeocoder tries each geocoder in order until one finds a place
+type FallbackGeocoder []Geocoder
+
+func (f FallbackGeocoder) Name() string {
+	names := make([]string, len(f))
+	for i, g := range f {
+		names[i] = g.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f FallbackGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	var errs []error
+	for _, g := range f {
+		place, err := g.ReverseGeocode(lat, lon)
+		if err == nil {
+			return place, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", g.Name(), err))
+	}
+	return Place{}, errors.Join(errs...)
+}
+
+// ReverseGeocode looks up a position with the configured geocoders
+func ReverseGeocode(lat, lon float64) (Place, error) {
+	return currentConfig().geocoder.ReverseGeocode(lat, lon)
+}
+
+// RadarGeocoder is a Geocoder backed by the Radar.io API
+type RadarGeocoder struct{}
+
+func (RadarGeocoder) Name() string {
+	return "radar"
+}
+
+func (RadarGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	resp, err := RadarReverseGeocode(lat, lon)
+	if err != nil {
+		return Place{}, err
+	}
+	if len(resp.Addresses) == 0 {
+		return Place{}, errors.New("no address found")
+	}
+	addr := resp.Addresses[0]
+	return Place{
+		City:        addr.City,
+		County:      addr.County,
+		State:       addr.State,
+		StateCode:   addr.StateCode,
+		Country:     addr.Country,
+		CountryCode: addr.CountryCode,
+	}, nil
+}
+
+// newGeocoder builds the geocoder chain from the configured backend names
+func newGeocoder(cfg GeocodingConfig) (Geocoder, error) {
+	var chain FallbackGeocoder
+	for _, name := range cfg.Backends {
+		switch strings.ToLower(name) {
+		case "radar":
+			chain = append(chain, RadarGeocoder{})
+		case "nominatim":
+			g, err := NewNominatimGeocoder(cfg.Nominatim, cfg.Language)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, g)
+		case "photon":
+			g, err := NewPhotonGeocoder(cfg.Photon, cfg.Language)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, g)
+		case "offline":
+			g, err := NewOfflineGeocoder(cfg.Offline)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, g)
+		default:
+			return nil, fmt.Errorf("unknown geocoder %q", name)
+		}
+	}
+	var geocoder Geocoder = chain
+	if len(chain) == 1 {
+		geocoder = chain[0]
+	}
+	if cfg.Cache.Enabled {
+		geocoder = NewCachedGeocoder(geocoder, cfg.Cache, cfg.Language)
+	}
+	return geocoder, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+// Base32 alphabet used by geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash encodes a position as a geohash of the given length. Nearby points share a prefix, and each extra
+// character makes the cell smaller (7 characters is about 150 m across).
+func Geohash(lat, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bits, ch, even := 0, 0, true
+	for len(hash) < precision {
+		// Bits alternate between longitude and latitude, starting with longitude
+		rng, val := &latRange, lat
+		if even {
+			rng, val = &lonRange, lon
+		}
+		mid := (rng[0] + rng[1]) / 2
+		ch <<= 1
+		if val >= mid {
+			ch |= 1
+			rng[0] = mid
+		} else {
+			rng[1] = mid
+		}
+		even = !even
+		if bits++; bits == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		// San Francisco
+		{37.7749, -122.4194, 9, "9q8yyk8yt"},
+		{37.7749, -122.4194, 5, "9q8yy"},
+		{37.7749, -122.4194, 1, "9"},
+		// Examples from the original geohash description
+		{42.6, -5.6, 5, "ezs42"},
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		// Southern and eastern hemispheres
+		{-33.8688, 151.2093, 7, "r3gx2f7"},
+	}
+	for _, tt := range tests {
+		if got := Geohash(tt.lat, tt.lon, tt.precision); got != tt.want {
+			t.Errorf("Geohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.precision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HistoryConfig configures the per-sonde telemetry history kept in Redis streams
+type HistoryConfig struct {
+	// Seconds between stored packets, packets in between are skipped
+	Interval int64 `yaml:"interval" env:"HISTORY_INTERVAL"`
+	// Seconds a sonde's history is kept after its last packet
+	Retention int64 `yaml:"retention" env:"HISTORY_RETENTION"`
+}
+
+// HistoryEntry is one stored packet of a sonde's flight
+type HistoryEntry struct {
+	Time   int64 // When we received it, from the (possibly virtual) clock
+	Packet SHPacket
+}
+
+// packetTime is the time the sonde sent the packet, or when we received it if the packet has none
+func (h HistoryEntry) packetTime() time.Time {
+	if h.Packet.Datetime.IsZero() {
+		return time.Unix(h.Time, 0)
+	}
+	return h.Packet.Datetime
+}
+
+// TrackPoint is one position of a sonde's flight
+type TrackPoint struct {
+	Time int64
+	Lat  float64
+	Lon  float64
+	Alt  float64 // Altitude in meters
+}
+
+// recordHistory appends the packet to the sonde's history, at most one packet every history interval
+func recordHistory(pkt SHPacket, session *SondeSession, now int64) {
+	cfg := currentConfig().History
+	if session.HistoryTime != 0 && now-session.HistoryTime < cfg.Interval {
+		return
+	}
+	// Landed sondes can keep transmitting for days, only the landing spot is worth keeping
+	if session.Phase == PhaseLanded && session.HistoryTime >= session.PhaseTime {
+		return
+	}
+	if err := redisclient.AppendHistory(context.Background(), pkt.Serial, now, pkt, cfg.Retention); err != nil {
+		fmt.Println("Error saving telemetry history:", err)
+		return
+	}
+	session.HistoryTime = now
+}
+
+// LoadHistory returns every stored packet of a sonde, oldest first
+func LoadHistory(serial string) ([]HistoryEntry, error) {
+	return redisclient.History(context.Background(), serial)
+}
+
+// historyTrack returns the positions of a sonde's stored history
+func historyTrack(history []HistoryEntry) []TrackPoint {
+	track := make([]TrackPoint, len(history))
+	for i, h := range history {
+		track[i] = TrackPoint{Time: h.Time, Lat: h.Packet.Lat, Lon: h.Packet.Lon, Alt: h.Packet.Alt}
+	}
+	return track
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Zoom level used for the final landing map, close enough to pick out fields and tree lines
+const landingMapZoom = 17
+
+// sendLandingSummary edits the sonde's original message in every region into a final summary of the flight.
+// It only uses what is stored in the session, so it works for landings detected by the lost signal sweeper too.
+func sendLandingSummary(serial string, session *SondeSession) {
+	var fields []DiscordField
+	fields = append(fields, DiscordField{
+		Name: fmt.Sprintf("Last known position: %.5f, %.5f", session.LastLat, session.LastLon),
+		Value: fmt.Sprintf("[Google Maps](https://www.google.com/maps/search/?api=1&query=%.6f,%.6f) | [OpenStreetMap](https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=16/%.6f/%.6f)",
+			session.LastLat, session.LastLon, session.LastLat, session.LastLon, session.LastLat, session.LastLon),
+	})
+
+	landLoc, err := ReverseGeocode(session.LastLat, session.LastLon)
+	if err != nil {
+		fmt.Println("Error reverse geocoding landing:", err)
+	} else {
+		fields = append(fields, DiscordField{
+			Name:  fmt.Sprintf("Landed near %s", landLoc),
+			Value: zeroWidthSpace,
+		})
+	}
+
+	if session.FirstSeen != 0 && session.LastSeen > session.FirstSeen {
+		fields = append(fields, DiscordField{
+			Name:  fmt.Sprintf("Flight duration: %s", formatDuration(time.Duration(session.LastSeen-session.FirstSeen)*time.Second)),
+			Value: zeroWidthSpace,
+		})
+	}
+
+	fields = append(fields, DiscordField{
+		Name:  fmt.Sprintf("Max altitude: %s ft (%s m)", humanize.Comma(int64(MetersToFeet(session.MaxAlt))), humanize.Comma(int64(session.MaxAlt))),
+		Value: zeroWidthSpace,
+	})
+
+	if session.LaunchLat != 0 || session.LaunchLon != 0 {
+		fields = append(fields, DiscordField{
+			Name:  fmt.Sprintf("Distance from launch site: %.1f mi", haversineMiles(session.LaunchLat, session.LaunchLon, session.LastLat, session.LastLon)),
+			Value: zeroWidthSpace,
+		})
+	}
+
+	receiversMutex.RLock()
+	point, dist, recerr := FindClosestPoint(session.LastLat, session.LastLon, receivers)
+	receiversMutex.RUnlock()
+	if recerr != nil {
+		fmt.Println("Error finding closest receiver:", recerr)
+	} else if point.Name != "" {
+		fields = append(fields, DiscordField{
+			Name:  fmt.Sprintf("Nearest receiver: **%s** (%.1f mi)", point.Name, dist),
+			Value: zeroWidthSpace,
+		})
+	}
+	if field, ok := drivingField("Drive to landing", session.LastLat, session.LastLon); ok {
+		fields = append(fields, field)
+	}
+
+	embed := DiscordEmbed{
+		Type:   "rich",
+		Title:  fmt.Sprintf("%s %s", PhaseLanded.EmbedTitle(session.SondeType, serial), session.FromText),
+		Color:  PhaseLanded.Style().Color,
+		Url:    fmt.Sprintf("https://sondehub.org/%s", serial),
+		Fields: fields,
+	}
+
+	history, err := LoadHistory(serial)
+	if err != nil {
+		fmt.Println("Error loading history:", err)
+	}
+	pred := predictions.Get(serial)
+
+	// The landing map and flight replay are laid out by each region's map profile, rendered once per profile
+	rendered := make(map[*MapProfile][]DiscordFile)
+	for name := range session.Regions {
+		profile := regionMapProfile(name)
+		if _, ok := rendered[profile]; !ok {
+			rendered[profile] = renderLandingMaps(serial, session, history, pred, profile)
+		}
+	}
+
+	var files []DiscordFile
+	var chartEmbed *DiscordEmbed
+	if currentConfig().Map.Charts && len(history) > 1 {
+		charts, err := RenderTelemetryCharts(session, history)
+		if err != nil {
+			fmt.Println("Error rendering telemetry charts:", err)
+		} else {
+			chartName := fmt.Sprintf("charts_%s.png", serial)
+			chartEmbed = &DiscordEmbed{
+				Type:  "rich",
+				Color: embed.Color,
+				Image: &EmbedImage{URL: "attachment://" + chartName},
+			}
+			files = append(files, DiscordFile{Name: chartName, Description: "Telemetry charts", Data: charts.Bytes()})
+		}
+	}
+	// Recovery teams can load the track straight into their phones
+	if len(history) > 0 {
+		files = append(files, exportAttachments(serial, history, pred)...)
+	}
+
+	for name, msg := range session.Regions {
+		maps := rendered[regionMapProfile(name)]
+		regionFiles := slices.Concat(maps, files)
+		regionEmbed := embed
+		if slices.ContainsFunc(maps, func(f DiscordFile) bool { return f.Name == landingMapName(serial) }) {
+			regionEmbed.Image = &EmbedImage{URL: "attachment://" + landingMapName(serial)}
+		}
+		embeds := []DiscordEmbed{regionEmbed}
+		if chartEmbed != nil {
+			embeds = append(embeds, *chartEmbed)
+		}
+		if len(regionFiles) > 0 {
+			_, err = SendUpdatedWebhookWithFiles(msg.Webhook, embeds, regionFiles)
+		} else {
+			_, err = SendDiscordWebhook(DiscordMessage{Embeds: embeds}, msg.Webhook, true)
+		}
+		if err != nil {
+			fmt.Printf("Error sending landing summary to %s: %v\n", name, err)
+		}
+	}
+}
+
+// landingMapName is the attachment name of the landing map
+func landingMapName(serial string) string {
+	return fmt.Sprintf("landing_%s.png", serial)
+}
+
+// renderLandingMaps renders the landing map and, when enabled, the flight replay with the profile
+func renderLandingMaps(serial string, session *SondeSession, history []HistoryEntry, pred *SHPredictionResult, profile *MapProfile) []DiscordFile {
+	var files []DiscordFile
+	buf, err := RenderLandingMapToBuffer(serial, session, profile)
+	if err != nil {
+		fmt.Println("Error rendering landing map:", err)
+	} else {
+		files = append(files, DiscordFile{Name: landingMapName(serial), Description: "Landing map", Data: buf.Bytes()})
+	}
+	if currentConfig().Map.Animation && len(history) > 1 {
+		anim, err := RenderFlightAnimation(serial, session, history, pred, profile)
+		if err != nil {
+			fmt.Println("Error rendering flight animation:", err)
+		} else {
+			files = append(files, DiscordFile{Name: fmt.Sprintf("flight_%s.gif", serial), Description: "Flight replay", Data: anim.Bytes()})
+		}
+	}
+	return files
+}
+
+// formatDuration formats a duration as e.g. "1h 42m"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	if h == 0 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh %dm", h, m)
+}
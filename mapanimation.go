@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"math"
+
+	"github.com/dustin/go-humanize"
+	staticmaps "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+)
+
+const (
+	// The track is sampled down to this many frames, however long the flight was
+	animationFrames = 60
+	// Frame delays in 1/100 s, the last frame is held so the landing can be seen
+	animationDelay = 8
+	animationHold  = 300
+)
+
+// Frames are drawn with the Plan 9 palette minus one entry, which is used for pixels that didn't change
+// since the previous frame. Unchanged pixels compress to almost nothing, which keeps the GIF small.
+var animationPalette = append(append(color.Palette{}, palette.Plan9[:255]...), color.RGBA{})
+
+const animationTransparent = 255
+
+// RenderFlightAnimation renders an animated GIF of the sonde moving along its stored track, with the time
+// and altitude in the corner and the prediction target (pred may be nil). The map is laid out by the
+// profile and rendered once, and every frame is drawn on top of it. With a minimum zoom the animation
+// only shows the end of a flight that doesn't fit.
+func RenderFlightAnimation(serial string, session *SondeSession, history []HistoryEntry, pred *SHPredictionResult, profile *MapProfile) (*bytes.Buffer, error) {
+	if len(history) < 2 {
+		return nil, errors.New("not enough history to animate")
+	}
+	tiles, err := tileProvider(profile.Tiles)
+	if err != nil {
+		return nil, err
+	}
+	targetImg, _ := loadPNGAsImage(profile.TargetIcon)
+
+	m := buildAnimationMap(profile, tiles, history, pred, targetImg)
+	// The center is fixed, so the track can be placed on the map staticmaps crops to the profile's size
+	center := flightCenter(history, pred)
+	if profile.belowMinZoom(m, tiles) {
+		// Like the update map, zoom in on the end of the flight and leave out what's past the edges
+		last := history[len(history)-1].Packet
+		center = s2.LatLngFromDegrees(last.Lat, last.Lon)
+		west, east, err := profile.minZoomEdges(tiles, center)
+		if err != nil {
+			return nil, err
+		}
+		i := len(history)
+		for i > 0 && history[i-1].Packet.Lon >= west && history[i-1].Packet.Lon <= east {
+			i--
+		}
+		history = history[i:]
+		if len(history) < 2 {
+			return nil, errors.New("not enough history in view to animate")
+		}
+		if pred != nil && (pred.Longitude < west || pred.Longitude > east) {
+			pred = nil
+		}
+		m = buildAnimationMap(profile, tiles, history, pred, targetImg)
+		m.SetZoom(profile.MinZoom)
+	}
+	m.SetCenter(center)
+
+	attribution, err := profile.renderAttribution(tiles, serial, session.SondeType, session.Phase, history[len(history)-1].packetTime())
+	if err != nil {
+		return nil, err
+	}
+	m.OverrideAttribution(attribution)
+
+	base, err := m.Render()
+	if err != nil {
+		return nil, fmt.Errorf("map render error: %w", err)
+	}
+	trans, err := m.Transformer()
+	if err != nil {
+		return nil, fmt.Errorf("map render error: %w", err)
+	}
+
+	// Pixel positions of the whole track, and which part of the flight each point is in. The transformer
+	// works on the whole tiles around the map, with the center of the map in the middle of the crop.
+	cx, cy := trans.LatLngToXY(center)
+	left, top := cx-float64(profile.Width/2), cy-float64(profile.Height/2)
+	points := make([][2]float64, len(history))
+	for i, h := range history {
+		x, y := trans.LatLngToXY(s2.LatLngFromDegrees(h.Packet.Lat, h.Packet.Lon))
+		points[i] = [2]float64{x - left, y - top}
+	}
+	burst := session.Phase == PhaseBurst || session.Phase == PhaseDescent || session.Phase == PhaseLanded
+	descending := func(i int) bool {
+		return burst && history[i].Time > session.MaxAltTime
+	}
+
+	anim := &gif.GIF{}
+	colors := make(map[color.RGBA]uint8)
+	var prev *image.Paletted
+	frames := min(animationFrames, len(history))
+	for f := 0; f < frames; f++ {
+		last := f * (len(history) - 1) / (frames - 1)
+
+		gc := gg.NewContextForImage(base)
+		gc.SetLineWidth(3)
+		for i := 1; i <= last; i++ {
+			if descending(i) {
+				gc.SetColor(descentTrackColor)
+			} else {
+				gc.SetColor(ascentTrackColor)
+			}
+			gc.DrawLine(points[i-1][0], points[i-1][1], points[i][0], points[i][1])
+			gc.Stroke()
+		}
+		gc.DrawCircle(points[last][0], points[last][1], 6)
+		gc.SetRGB(1, 0, 0)
+		gc.FillPreserve()
+		gc.SetRGB(0, 0, 0)
+		gc.SetLineWidth(1.5)
+		gc.Stroke()
+
+		h := history[last]
+		label := fmt.Sprintf("%s UTC  %s ft", h.packetTime().UTC().Format("15:04:05"), humanize.Comma(int64(MetersToFeet(h.Packet.Alt))))
+		w, _ := gc.MeasureString(label)
+		gc.SetRGBA(1, 1, 1, 0.85)
+		gc.DrawRoundedRectangle(10, 10, w+16, 24, 4)
+		gc.Fill()
+		gc.SetRGB(0, 0, 0)
+		gc.DrawStringAnchored(label, 18, 22, 0, 0.35)
+
+		frame, full := quantizeFrame(gc.Image().(*image.RGBA), prev, colors)
+		prev = full
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, animationDelay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	anim.Delay[len(anim.Delay)-1] = animationHold
+
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, anim); err != nil {
+		return nil, fmt.Errorf("gif encode error: %w", err)
+	}
+	return buf, nil
+}
+
+// buildAnimationMap sets up the base map of the animation for the profile. The whole flight is drawn faintly,
+// so the map covers it and the trail has something to follow.
+func buildAnimationMap(profile *MapProfile, tiles *TileProviderConfig, history []HistoryEntry, pred *SHPredictionResult, targetImg image.Image) *staticmaps.Context {
+	m := staticmaps.NewContext()
+	m.SetSize(profile.Width, profile.Height)
+	m.SetMaxZoom(profile.MaxZoom)
+	tiles.apply(m)
+
+	var path []s2.LatLng
+	for _, h := range history {
+		path = append(path, s2.LatLngFromDegrees(h.Packet.Lat, h.Packet.Lon))
+	}
+	m.AddObject(staticmaps.NewPath(path, color.RGBA{A: 90}, 3))
+	if pred != nil {
+		addTargetMarker(m, pred, targetImg)
+	}
+	return m
+}
+
+// flightCenter is the middle of the flight and prediction target in the map projection, where staticmaps
+// would center the map on its own
+func flightCenter(history []HistoryEntry, pred *SHPredictionResult) s2.LatLng {
+	bounds := s2.EmptyRect()
+	for _, h := range history {
+		bounds = bounds.AddPoint(s2.LatLngFromDegrees(h.Packet.Lat, h.Packet.Lon))
+	}
+	if pred != nil {
+		bounds = bounds.AddPoint(s2.LatLngFromDegrees(pred.Latitude, pred.Longitude))
+	}
+	mercator := func(lat float64) float64 { return math.Log((1+math.Sin(lat))/(1-math.Sin(lat))) / 2 }
+	lat := math.Atan(math.Sinh((mercator(bounds.Lo().Lat.Radians()) + mercator(bounds.Hi().Lat.Radians())) / 2))
+	return s2.LatLng{Lat: s1.Angle(lat), Lng: bounds.Center().Lng}
+}
+
+// quantizeFrame maps the frame onto the animation palette, leaving pixels that match the previous
+// frame transparent. full is the whole frame, to compare the next one against. colors caches the
+// palette index of every color seen so far.
+func quantizeFrame(img *image.RGBA, prev *image.Paletted, colors map[color.RGBA]uint8) (frame, full *image.Paletted) {
+	bounds := img.Bounds()
+	full = image.NewPaletted(bounds, animationPalette)
+	frame = image.NewPaletted(bounds, animationPalette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			idx, ok := colors[c]
+			if !ok {
+				idx = uint8(animationPalette[:animationTransparent].Index(c))
+				colors[c] = idx
+			}
+			i := full.PixOffset(x, y)
+			full.Pix[i] = idx
+			if prev != nil && prev.Pix[i] == idx {
+				frame.Pix[i] = animationTransparent
+			} else {
+				frame.Pix[i] = idx
+			}
+		}
+	}
+	return frame, full
+}
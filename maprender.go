@@ -3,157 +3,371 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
+	"math"
 	"os"
-	"path/filepath"
-	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	staticmaps "github.com/flopp/go-staticmaps"
+	"github.com/fogleman/gg"
 	"github.com/golang/geo/s2"
 )
 
-// RenderSondeMap renders a map with the radiosonde position, predicted path, and landing point.
-// It saves the PNG to the current directory with a timestamped filename.
-func RenderSondeMap(pkt SHPacket, shPred *SHPredictionResult) (string, error) {
-	m := staticmaps.NewContext()
-	m.SetSize(1280, 720)
-	m.SetMaxZoom(19) // Fixes Issue #8 - Map does not draw tiles at low altitudes
-
-	// Check altitude and determine if we show satellite imagery or standard map
-	altft := int(pkt.Alt * 3.28084) // Convert meters to feet
-	ftenv := os.Getenv("MAP_SATELLITE_ALTITUDE_FT")
-	mapSatelliteAltitudeFt := 10000 // Default to 10,000 feet if not set
-	if ftenv != "" {
-		if parsed, err := strconv.Atoi(ftenv); err == nil {
-			mapSatelliteAltitudeFt = parsed
-		}
+// Name of the map profile regions use unless they pick another one
+const defaultMapProfileName = "default"
+
+// MapProfile describes how the map in the update messages is drawn. Regions pick one by name, settings
+// left out of a profile are taken from the default profile.
+type MapProfile struct {
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+	// Zoom bounds. With a minimum zoom, a long predicted path runs off the map instead of zooming out to fit it.
+	MinZoom int `yaml:"min_zoom"`
+	MaxZoom int `yaml:"max_zoom"`
+	// Tile providers by name (osm, arcgis-worldimagery, opentopomap, carto-light_all, ...): the default one, the
+	// ones for particular flight phases, and the one used below map.satellite_altitude_ft once the sonde
+	// stops climbing (set it to the same as tiles to never switch)
+	Tiles      string                 `yaml:"tiles"`
+	PhaseTiles map[FlightPhase]string `yaml:"phase_tiles"`
+	LowTiles   string                 `yaml:"low_tiles"`
+	// PNG icons for the sonde going up and coming down, and for the predicted landing
+	BalloonIcon   string `yaml:"balloon_icon"`
+	ParachuteIcon string `yaml:"parachute_icon"`
+	TargetIcon    string `yaml:"target_icon"`
+	// Attribution line, a Go template with .Serial, .Type, .Phase, .Time (the packet time in UTC) and .Tiles
+	// (the tile provider's attribution)
+	Attribution string `yaml:"attribution"`
+
+	attribution *template.Template
+}
+
+// defaultMapProfile is the map the updates have always had
+func defaultMapProfile() *MapProfile {
+	return &MapProfile{
+		Width:   1280,
+		Height:  720,
+		MaxZoom: 19, // Fixes Issue #8 - Map does not draw tiles at low altitudes
+		Tiles:   "osm",
+		// Satellite imagery helps finding sondes that are down, or about to be
+		LowTiles: "arcgis-worldimagery",
+		// Balloon and target icons © Rossen Georgiev, MIT License, https://github.com/projecthorus/sondehub-tracker
+		// NOTE: Convert assets/balloon.svg and assets/target.svg to assets/balloon.png and assets/target.png for best results.
+		BalloonIcon:   "assets/balloon.png",
+		ParachuteIcon: "assets/parachute.png",
+		TargetIcon:    "assets/target.png",
+		Attribution:   `Balloony - Tracking {{.Type}} {{.Serial}} on {{.Time.Format "01/02/2006 15:04:05"}} (UTC) - {{with .Tiles}}{{.}} - {{end}}Thanks to SondeHub!`,
 	}
+}
 
-	// This may need to be ajusted later, but I think allowing a 0.2m/s velocity threshold will catch tree landers or other sondes that continue to ping
-	if altft < mapSatelliteAltitudeFt && pkt.VelV <= 0.2 {
-		// Use satellite imagery for low altitudes
-		m.SetTileProvider(staticmaps.NewTileProviderArcgisWorldImagery())
-	} else {
-		m.SetTileProvider(staticmaps.NewTileProviderOpenStreetMaps())
+// validate fills in the settings the profile leaves out from defaults and returns every problem with it.
+// Tile providers are looked up in the configured ones as well as the built in ones.
+func (p *MapProfile) validate(defaults *MapProfile, providers map[string]*TileProviderConfig) []fieldError {
+	var errs []fieldError
+	if p.Width == 0 {
+		p.Width = defaults.Width
 	}
+	if p.Height == 0 {
+		p.Height = defaults.Height
+	}
+	if p.MaxZoom == 0 {
+		p.MaxZoom = defaults.MaxZoom
+	}
+	p.Tiles = defaultString(p.Tiles, defaults.Tiles)
+	p.LowTiles = defaultString(p.LowTiles, defaults.LowTiles)
+	p.BalloonIcon = defaultString(p.BalloonIcon, defaults.BalloonIcon)
+	p.ParachuteIcon = defaultString(p.ParachuteIcon, defaults.ParachuteIcon)
+	p.TargetIcon = defaultString(p.TargetIcon, defaults.TargetIcon)
+	p.Attribution = defaultString(p.Attribution, defaults.Attribution)
 
-	// Determine cache directory from env or default
-	cacheDir := os.Getenv("TILE_CACHE_DIR")
-	if cacheDir == "" {
-		cacheDir = "tilecache"
+	if p.Width <= 0 || p.Height <= 0 {
+		errs = append(errs, fieldError{"width", "width and height must be greater than 0"})
+	}
+	if p.MaxZoom < 1 || p.MaxZoom > 20 {
+		errs = append(errs, fieldError{"max_zoom", "must be between 1 and 20"})
+	}
+	if p.MinZoom < 0 || p.MinZoom > p.MaxZoom {
+		errs = append(errs, fieldError{"min_zoom", "must be between 0 and max_zoom"})
+	}
+	if _, err := lookupTileProvider(p.Tiles, providers); err != nil {
+		errs = append(errs, fieldError{"tiles", err.Error()})
+	}
+	if _, err := lookupTileProvider(p.LowTiles, providers); err != nil {
+		errs = append(errs, fieldError{"low_tiles", err.Error()})
+	}
+	for phase, name := range p.PhaseTiles {
+		if _, ok := phaseStyles[phase]; !ok {
+			errs = append(errs, fieldError{"phase_tiles." + string(phase), "unknown flight phase"})
+		} else if _, err := lookupTileProvider(name, providers); err != nil {
+			errs = append(errs, fieldError{"phase_tiles." + string(phase), err.Error()})
+		}
 	}
-	m.SetCache(staticmaps.NewTileCache(cacheDir, 0o755))
+	tmpl, err := template.New("attribution").Parse(p.Attribution)
+	if err != nil {
+		errs = append(errs, fieldError{"attribution", err.Error()})
+	}
+	p.attribution = tmpl
+	return errs
+}
 
-	// Attribution for icons
-	// Balloon and target icons © Rossen Georgiev, MIT License, https://github.com/projecthorus/sondehub-tracker
-	// NOTE: Convert assets/balloon.svg and assets/target.svg to assets/balloon.png and assets/target.png for best results.
+// mapProfile returns the named map profile, or the default one if it was removed by a reload
+func mapProfile(name string) *MapProfile {
+	profiles := currentConfig().Map.Profiles
+	if p, ok := profiles[name]; ok {
+		return p
+	}
+	return profiles[defaultMapProfileName]
+}
 
-	balloonImgPath := "assets/balloon.png"
-	if pkt.VelV < 0 {
-		balloonImgPath = "assets/parachute.png"
+// regionMapProfile returns the map profile of a region, the default one if the region was removed
+func regionMapProfile(name string) *MapProfile {
+	if r := regionByName(name); r != nil {
+		return mapProfile(r.MapProfile)
 	}
-	balloonImg, _ := loadPNGAsImage(balloonImgPath)
-	targetImg, _ := loadPNGAsImage("assets/target.png")
+	return mapProfile(defaultMapProfileName)
+}
 
-	addTargetMarker(m, shPred, targetImg)
+// tilesFor picks the profile's tile provider for where the sonde is
+func (p *MapProfile) tilesFor(pkt SHPacket, phase FlightPhase) string {
+	// This may need to be ajusted later, but I think allowing a 0.2m/s velocity threshold will catch tree landers or other sondes that continue to ping
+	if MetersToFeet(pkt.Alt) < float64(currentConfig().Map.SatelliteAltitudeFt) && pkt.VelV <= 0.2 {
+		return p.LowTiles
+	}
+	return defaultString(p.PhaseTiles[phase], p.Tiles)
+}
 
-	balloonRendered, err := renderPathAndBalloon(m, shPred, balloonImg)
-	if err != nil {
-		fmt.Println("[WARN] Could not parse shPred.Data as objects:", err)
-		fmt.Println("Raw shPred.Data:", shPred.Data)
+// RenderSondeMap renders the update map as laid out by the profile and writes it to w as a PNG: the
+// radiosonde position, the flown track (when there is one) with a legend, the predicted path and the
+// landing point. session may be nil.
+func RenderSondeMap(w io.Writer, profile *MapProfile, pkt SHPacket, shPred *SHPredictionResult, session *SondeSession, track []TrackPoint) error {
+	var phase FlightPhase
+	if session != nil {
+		phase = session.Phase
 	}
-	if !balloonRendered {
-		addBalloonFallback(m, pkt, balloonImg)
+	tiles, err := tileProvider(profile.tilesFor(pkt, phase))
+	if err != nil {
+		return err
 	}
 
-	m.OverrideAttribution(fmt.Sprintf("Balloony - Tracking %s %s on %s - Thanks to OpenStreetMap contributors and SondeHub!", pkt.Type, pkt.Serial, pkt.Datetime.Format("01/02/2006")))
-
-	// Ensure render_debug directory exists
-	outputDir := "render_debug"
-	if err := os.MkdirAll(outputDir, 0o755); err != nil {
-		return "", fmt.Errorf("failed to create output dir: %w", err)
+	m, legend := buildSondeMap(profile, tiles, pkt, shPred, session, track)
+	if profile.belowMinZoom(m, tiles) {
+		// Zoomed in on the sonde, the track and predicted path run off the map. staticmaps wraps anything
+		// past the left or right edge around the world, so they are cut off at the edges first.
+		center := s2.LatLngFromDegrees(pkt.Lat, pkt.Lon)
+		west, east, err := profile.minZoomEdges(tiles, center)
+		if err != nil {
+			return err
+		}
+		m, legend = buildSondeMap(profile, tiles, pkt, cropPrediction(shPred, west, east), session, cropTrack(track, west, east))
+		m.SetCenter(center)
+		m.SetZoom(profile.MinZoom)
 	}
 
-	img, err := m.Render()
+	attribution, err := profile.renderAttribution(tiles, pkt.Serial, pkt.Type, phase, pkt.Datetime)
 	if err != nil {
-		return "", fmt.Errorf("map render error: %w", err)
+		return err
 	}
+	m.OverrideAttribution(attribution)
 
-	filename := filepath.Join(outputDir, "sonde_map_"+strconv.FormatInt(time.Now().Unix(), 10)+".png")
-	f, err := os.Create(filename)
+	img, err := m.Render()
 	if err != nil {
-		return "", fmt.Errorf("file create error: %w", err)
+		return fmt.Errorf("map render error: %w", err)
 	}
-	defer f.Close()
-	if err := png.Encode(f, img); err != nil {
-		return "", fmt.Errorf("png encode error: %w", err)
+	if len(track) > 1 {
+		img = drawLegend(img, legend)
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("png encode error: %w", err)
 	}
-	return filename, nil
+	return nil
 }
 
-// RenderSondeMapToBuffer renders the map and returns the PNG as a bytes.Buffer (in-memory)
-func RenderSondeMapToBuffer(pkt SHPacket, shPred *SHPredictionResult) (*bytes.Buffer, error) {
-	m := staticmaps.NewContext()
-	m.SetSize(1280, 720)
-	m.SetMaxZoom(19) // Fixes Issue #8 - Map does not draw tiles at low altitudes
-
-	// Check altitude and determine if we show satellite imagery or standard map
-	altft := int(pkt.Alt * 3.28084) // Convert meters to feet
-	ftenv := os.Getenv("MAP_SATELLITE_ALTITUDE_FT")
-	mapSatelliteAltitudeFt := 10000 // Default to 10,000 feet if not set
-	if ftenv != "" {
-		if parsed, err := strconv.Atoi(ftenv); err == nil {
-			mapSatelliteAltitudeFt = parsed
-		}
+// renderAttribution fills in the profile's attribution template for a map drawn with tiles
+func (p *MapProfile) renderAttribution(tiles *TileProviderConfig, serial, sondeType string, phase FlightPhase, t time.Time) (string, error) {
+	var attribution strings.Builder
+	err := p.attribution.Execute(&attribution, struct {
+		Serial, Type string
+		Phase        FlightPhase
+		Time         time.Time
+		Tiles        string
+	}{serial, sondeType, phase, t.UTC(), tiles.provider.Attribution})
+	if err != nil {
+		return "", fmt.Errorf("attribution template error: %w", err)
 	}
+	return attribution.String(), nil
+}
 
-	// This may need to be ajusted later, but I think allowing a 0.2m/s velocity threshold will catch tree landers or other sondes that continue to ping
-	if altft < mapSatelliteAltitudeFt && pkt.VelV <= 0.2 {
-		// Use satellite imagery for low altitudes
-		m.SetTileProvider(staticmaps.NewTileProviderArcgisWorldImagery())
-	} else {
-		m.SetTileProvider(staticmaps.NewTileProviderOpenStreetMaps())
+// belowMinZoom returns true if staticmaps would zoom the map out further than the profile's minimum zoom
+func (p *MapProfile) belowMinZoom(m *staticmaps.Context, tiles *TileProviderConfig) bool {
+	if p.MinZoom == 0 {
+		return false
 	}
+	trans, err := m.Transformer()
+	return err == nil && mapZoom(trans, p.Width, tiles.provider.TileSize) < p.MinZoom
+}
 
-	cacheDir := os.Getenv("TILE_CACHE_DIR")
-	if cacheDir == "" {
-		cacheDir = "tilecache"
+// minZoomEdges returns the longitudes of the left and right edge of the profile's map centered on center
+// at its minimum zoom
+func (p *MapProfile) minZoomEdges(tiles *TileProviderConfig, center s2.LatLng) (west, east float64, err error) {
+	view := staticmaps.NewContext()
+	view.SetSize(p.Width, p.Height)
+	view.SetTileProvider(tiles.provider)
+	view.SetCenter(center)
+	view.SetZoom(p.MinZoom)
+	trans, err := view.Transformer()
+	if err != nil {
+		return 0, 0, fmt.Errorf("map render error: %w", err)
 	}
-	m.SetCache(staticmaps.NewTileCache(cacheDir, 0o755))
+	x, y := trans.LatLngToXY(center)
+	west = trans.XYToLatLng(x-float64(p.Width)/2, y).Lng.Degrees()
+	east = trans.XYToLatLng(x+float64(p.Width)/2, y).Lng.Degrees()
+	return west, east, nil
+}
+
+// buildSondeMap sets up the map context for the profile and adds everything RenderSondeMap draws.
+// It returns the legend entries for what was added.
+func buildSondeMap(profile *MapProfile, tiles *TileProviderConfig, pkt SHPacket, shPred *SHPredictionResult, session *SondeSession, track []TrackPoint) (*staticmaps.Context, []legendEntry) {
+	m := staticmaps.NewContext()
+	m.SetSize(profile.Width, profile.Height)
+	m.SetMaxZoom(profile.MaxZoom)
+	tiles.apply(m)
 
-	balloonImgPath := "assets/balloon.png"
+	balloonImgPath := profile.BalloonIcon
 	if pkt.VelV < 0 {
-		balloonImgPath = "assets/parachute.png"
+		balloonImgPath = profile.ParachuteIcon
 	}
 	balloonImg, _ := loadPNGAsImage(balloonImgPath)
-	targetImg, _ := loadPNGAsImage("assets/target.png")
+	targetImg, _ := loadPNGAsImage(profile.TargetIcon)
+
+	// The flown track goes under the prediction, which starts where the track ends
+	legend := addFlightTrack(m, session, track)
 
 	addTargetMarker(m, shPred, targetImg)
 	balloonRendered, err := renderPathAndBalloon(m, shPred, balloonImg)
 	if err != nil {
 		fmt.Println("[WARN] Could not parse shPred.Data as objects:", err)
 		fmt.Println("Raw shPred.Data:", shPred.Data)
+	} else if shPred.Local {
+		legend = append(legend, legendEntry{Label: "Predicted (local estimate)", Color: predictedPathColor})
+	} else {
+		legend = append(legend, legendEntry{Label: "Predicted", Color: predictedPathColor})
 	}
 	if !balloonRendered {
 		addBalloonFallback(m, pkt, balloonImg)
 	}
+	return m, legend
+}
+
+// cropTrack keeps the end of the track that lies between the west and east longitudes
+func cropTrack(track []TrackPoint, west, east float64) []TrackPoint {
+	i := len(track)
+	for i > 0 && track[i-1].Lon >= west && track[i-1].Lon <= east {
+		i--
+	}
+	return track[i:]
+}
 
-	m.OverrideAttribution(fmt.Sprintf("Balloony - Tracking %s %s on %s (UTC) - Thanks to OpenStreetMap contributors and SondeHub!", pkt.Type, pkt.Serial, pkt.Datetime.Format("01/02/2006 15:04:05")))
+// cropPrediction keeps the start of the predicted path that lies between the west and east longitudes.
+// The landing point itself stays, markers past the edges are simply not drawn.
+func cropPrediction(pred *SHPredictionResult, west, east float64) *SHPredictionResult {
+	cropped := *pred
+	cropped.Path = nil
+	for _, pt := range pred.Path {
+		if pt.Lon < west || pt.Lon > east {
+			break
+		}
+		cropped.Path = append(cropped.Path, pt)
+	}
+	data, err := json.Marshal(cropped.Path)
+	if err == nil {
+		cropped.Data = string(data)
+	}
+	return &cropped
+}
 
-	img, err := m.Render()
+// runRenderCommand renders a sonde's update map from its stored history to a file, to try out map profiles
+func runRenderCommand(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	profileName := fs.String("profile", defaultMapProfileName, "map profile to render with")
+	output := fs.String("o", "", "output file, - for stdout (default <serial>.png)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: balloony render [-profile name] [-o file] <serial>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a serial is required")
+	}
+	serial := fs.Arg(0)
+	profile, ok := currentConfig().Map.Profiles[*profileName]
+	if !ok {
+		return fmt.Errorf("unknown map profile %q", *profileName)
+	}
+
+	history, err := LoadHistory(serial)
 	if err != nil {
-		return nil, fmt.Errorf("map render error: %w", err)
+		return err
+	}
+	if len(history) == 0 {
+		return fmt.Errorf("no history stored for %s", serial)
+	}
+	pkt := history[len(history)-1].Packet
+	track := historyTrack(history)
+	// Sessions expire long before the history does, the map is drawn without the phase then
+	session, err := redisclient.GetSondeSession(serial)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		session = &SondeSession{}
+	}
+	// Like the updates, fall back to our own prediction when SondeHub has none
+	pred, err := GetPrediction(serial)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Using a local prediction:", err)
+		if pred, err = LocalPrediction(pkt, session, track); err != nil {
+			return err
+		}
 	}
 
-	buf := new(bytes.Buffer)
-	if err := png.Encode(buf, img); err != nil {
-		return nil, fmt.Errorf("png encode error: %w", err)
+	var buf bytes.Buffer
+	if err := RenderSondeMap(&buf, profile, pkt, pred, session, track); err != nil {
+		return err
 	}
-	return buf, nil
+	switch *output {
+	case "-":
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	case "":
+		*output = serial + ".png"
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Rendered %s with the %s profile to %s\n", serial, *profileName, *output)
+	return nil
+}
+
+// mapZoom works out the zoom level staticmaps picked, from how many degrees of longitude fit across the map
+func mapZoom(trans *staticmaps.Transformer, width, tileSize int) int {
+	west := trans.XYToLatLng(0, 0).Lng.Degrees()
+	east := trans.XYToLatLng(float64(width), 0).Lng.Degrees()
+	span := east - west
+	if span <= 0 {
+		// Across the antimeridian
+		span += 360
+	}
+	return int(math.Round(math.Log2(360 * float64(width) / float64(tileSize) / span)))
 }
 
 // Helper: Add target marker or image
@@ -189,7 +403,7 @@ func renderPathAndBalloon(m *staticmaps.Context, shPred *SHPredictionResult, bal
 		for _, pt := range pathObjs {
 			polyline = append(polyline, s2.LatLngFromDegrees(pt.Lat, pt.Lon))
 		}
-		m.AddObject(staticmaps.NewPath(polyline, color.RGBA{R: 255, A: 255}, 4))
+		m.AddObject(staticmaps.NewPath(polyline, predictedPathColor, 4))
 		if balloonImg != nil {
 			first := pathObjs[0]
 			imgW := float64(balloonImg.Bounds().Dx())
@@ -234,3 +448,157 @@ func loadPNGAsImage(path string) (image.Image, error) {
 	}
 	return img, nil
 }
+
+// RenderLandingMapToBuffer renders a close-up map of the last known position for the landing summary, laid
+// out by the profile with its low altitude (satellite) tiles
+func RenderLandingMapToBuffer(serial string, session *SondeSession, profile *MapProfile) (*bytes.Buffer, error) {
+	tiles, err := tileProvider(profile.LowTiles)
+	if err != nil {
+		return nil, err
+	}
+	m := staticmaps.NewContext()
+	m.SetSize(profile.Width, profile.Height)
+	m.SetMaxZoom(profile.MaxZoom)
+	m.SetZoom(max(min(landingMapZoom, profile.MaxZoom), profile.MinZoom))
+	m.SetCenter(s2.LatLngFromDegrees(session.LastLat, session.LastLon))
+	tiles.apply(m)
+
+	targetImg, _ := loadPNGAsImage(profile.TargetIcon)
+	addTargetMarker(m, &SHPredictionResult{Latitude: session.LastLat, Longitude: session.LastLon}, targetImg)
+
+	attribution, err := profile.renderAttribution(tiles, serial, session.SondeType, session.Phase, time.Unix(session.LastSeen, 0))
+	if err != nil {
+		return nil, err
+	}
+	m.OverrideAttribution(attribution)
+
+	img, err := m.Render()
+	if err != nil {
+		return nil, fmt.Errorf("map render error: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("png encode error: %w", err)
+	}
+	return buf, nil
+}
+
+// Colors of the flown track match the embed colors of the ascent and descent phases
+var (
+	ascentTrackColor   = phaseColor(PhaseAscent)
+	descentTrackColor  = phaseColor(PhaseDescent)
+	burstMarkerColor   = phaseColor(PhaseBurst)
+	launchMarkerColor  = color.RGBA{R: 0x2E, G: 0xCC, B: 0x71, A: 255}
+	predictedPathColor = color.RGBA{R: 255, A: 255}
+	trackCasingColor   = color.RGBA{A: 160}
+)
+
+// phaseColor turns a phase's embed color into a color.Color
+func phaseColor(p FlightPhase) color.RGBA {
+	c := p.Style().Color
+	return color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 255}
+}
+
+// legendEntry is one line of the map legend, a line for paths or a dot for markers
+type legendEntry struct {
+	Label  string
+	Color  color.Color
+	Marker bool
+}
+
+// addFlightTrack draws the flown track, split at the burst, and marks the launch site and burst point.
+// It returns the legend entries for what was drawn.
+func addFlightTrack(m *staticmaps.Context, session *SondeSession, track []TrackPoint) []legendEntry {
+	if session == nil || len(track) < 2 {
+		return nil
+	}
+	burst := session.Phase == PhaseBurst || session.Phase == PhaseDescent || session.Phase == PhaseLanded
+
+	var ascent, descent []s2.LatLng
+	for _, pt := range track {
+		ll := s2.LatLngFromDegrees(pt.Lat, pt.Lon)
+		if !burst || pt.Time <= session.MaxAltTime {
+			ascent = append(ascent, ll)
+		} else {
+			if len(descent) == 0 && len(ascent) > 0 {
+				// Start at the last ascent point, so the two halves join up
+				descent = append(descent, ascent[len(ascent)-1])
+			}
+			descent = append(descent, ll)
+		}
+	}
+
+	var legend []legendEntry
+	for _, part := range []struct {
+		path  []s2.LatLng
+		color color.Color
+		label string
+	}{
+		{ascent, ascentTrackColor, "Ascent"},
+		{descent, descentTrackColor, "Descent"},
+	} {
+		if len(part.path) < 2 {
+			continue
+		}
+		// A dark casing keeps the light track colors visible on any map
+		m.AddObject(staticmaps.NewPath(part.path, trackCasingColor, 6))
+		m.AddObject(staticmaps.NewPath(part.path, part.color, 3))
+		legend = append(legend, legendEntry{Label: part.label, Color: part.color})
+	}
+
+	if session.LaunchLat != 0 || session.LaunchLon != 0 {
+		marker := staticmaps.NewMarker(s2.LatLngFromDegrees(session.LaunchLat, session.LaunchLon), launchMarkerColor, 16)
+		marker.Label = "L"
+		m.AddObject(marker)
+		legend = append(legend, legendEntry{Label: "Launch", Color: launchMarkerColor, Marker: true})
+	}
+	if burst && session.MaxAltTime != 0 {
+		marker := staticmaps.NewMarker(s2.LatLngFromDegrees(session.MaxAltLat, session.MaxAltLon), burstMarkerColor, 16)
+		marker.Label = "B"
+		m.AddObject(marker)
+		legend = append(legend, legendEntry{Label: fmt.Sprintf("Burst (%s ft)", humanize.Comma(int64(MetersToFeet(session.MaxAlt)))), Color: burstMarkerColor, Marker: true})
+	}
+	return legend
+}
+
+// drawLegend draws the legend in the top left corner of the rendered map
+func drawLegend(img image.Image, entries []legendEntry) image.Image {
+	if len(entries) == 0 {
+		return img
+	}
+	const (
+		pad    = 8.0
+		row    = 18.0
+		swatch = 22.0
+	)
+	gc := gg.NewContextForImage(img)
+	width := 0.0
+	for _, e := range entries {
+		w, _ := gc.MeasureString(e.Label)
+		width = math.Max(width, w)
+	}
+	gc.SetRGBA(1, 1, 1, 0.85)
+	gc.DrawRoundedRectangle(10, 10, width+swatch+3*pad, float64(len(entries))*row+2*pad, 4)
+	gc.Fill()
+
+	for i, e := range entries {
+		y := 10 + pad + float64(i)*row + row/2
+		x := 10 + pad
+		gc.SetColor(e.Color)
+		if e.Marker {
+			gc.DrawCircle(x+swatch/2, y, 5)
+			gc.FillPreserve()
+			gc.SetRGB(0, 0, 0)
+			gc.SetLineWidth(1)
+			gc.Stroke()
+		} else {
+			gc.SetLineWidth(4)
+			gc.DrawLine(x, y, x+swatch, y)
+			gc.Stroke()
+		}
+		gc.SetRGB(0, 0, 0)
+		gc.DrawStringAnchored(e.Label, x+swatch+pad, y, 0, 0.35)
+	}
+	return gc.Image()
+}
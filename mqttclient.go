@@ -1,36 +1,144 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strings"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-var connectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
-	fmt.Println("[*] Connected to MQTT")
-	Subscribe(client, "batch")
+// MQTTConfig holds everything needed to connect to a SondeHub-compatible MQTT broker
+type MQTTConfig struct {
+	// Broker is a full broker URL, e.g. wss://host:443, ssl://host:8883 or tcp://host:1883
+	Broker   string `yaml:"broker" env:"MQTT_BROKER"`
+	ClientID string `yaml:"client_id" env:"MQTT_CLIENT_ID"`
+	Username string `yaml:"username" env:"MQTT_USERNAME"`
+	Password string `yaml:"password" env:"MQTT_PASSWORD"`
+	// Topics are subscribed to on every (re)connect, wildcards like sondes/+ are allowed
+	Topics []string `yaml:"topics" env:"MQTT_TOPICS"`
+	QoS    byte     `yaml:"qos" env:"MQTT_QOS"`
+	// Optional TLS settings for ssl:// and wss:// brokers
+	CACert             string `yaml:"tls_ca" env:"MQTT_TLS_CA"`
+	ClientCert         string `yaml:"tls_cert" env:"MQTT_TLS_CERT"`
+	ClientKey          string `yaml:"tls_key" env:"MQTT_TLS_KEY"`
+	InsecureSkipVerify bool   `yaml:"tls_insecure" env:"MQTT_TLS_INSECURE"`
+}
+
+// tlsConfig builds the TLS configuration for the broker, or nil if the defaults are fine
+func (cfg MQTTConfig) tlsConfig() (*tls.Config, error) {
+	if cfg.CACert == "" && cfg.ClientCert == "" && !cfg.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load MQTT client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
 }
 
 var connectLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
 	fmt.Printf("[!] Connect lost: %v\r\n", err)
 }
 
-func Subscribe(client mqtt.Client, topic string) {
-	token := client.Subscribe(topic, 1, nil)
+// SubscribeAll subscribes to every topic in one request
+func SubscribeAll(client mqtt.Client, topics []string, qos byte) {
+	filters := make(map[string]byte, len(topics))
+	for _, topic := range topics {
+		filters[topic] = qos
+	}
+	token := client.SubscribeMultiple(filters, nil)
 	if token.Wait() && token.Error() != nil {
-		fmt.Println("[!] Error subscribing to topic:", token.Error())
+		fmt.Println("[!] Error subscribing to topics:", token.Error())
 	} else {
-		fmt.Printf("[*] Subscribed to topic: %s\r\n", topic)
+		fmt.Printf("[*] Subscribed to topics: %s\r\n", strings.Join(topics, ", "))
 	}
 }
 
-func MQTTConnection(broker string, port int, clientID string, messageHandler mqtt.MessageHandler) mqtt.Client {
+func MQTTConnection(cfg MQTTConfig, messageHandler mqtt.MessageHandler) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("wss://%s:%d", broker, port))
-	opts.SetClientID(clientID)
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientID)
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+		opts.SetPassword(cfg.Password)
+	}
+	tlsCfg, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg != nil {
+		opts.SetTLSConfig(tlsCfg)
+	}
 	opts.SetDefaultPublishHandler(messageHandler)
-	opts.OnConnect = connectHandler
+	// OnConnect also runs after every automatic reconnect, so the subscriptions are always re-applied
+	opts.OnConnect = func(client mqtt.Client) {
+		fmt.Printf("[*] Connected to MQTT broker %s\r\n", cfg.Broker)
+		SubscribeAll(client, cfg.Topics, cfg.QoS)
+	}
 	opts.OnConnectionLost = connectLostHandler
 	opts.AutoReconnect = true
-	return mqtt.NewClient(opts)
+	return mqtt.NewClient(opts), nil
+}
+
+// SondeHubSource is a TelemetrySource backed by the SondeHub MQTT feed or any broker mirroring it
+type SondeHubSource struct {
+	cfg    MQTTConfig
+	client mqtt.Client
+}
+
+// NewSondeHubSource creates a SondeHubSource for the given broker, it does not connect until Start is called.
+func NewSondeHubSource(cfg MQTTConfig) *SondeHubSource {
+	return &SondeHubSource{cfg: cfg}
+}
+
+func (s *SondeHubSource) Name() string {
+	return "sondehub"
+}
+
+// Start connects to the broker and hands every parsed batch to handler
+func (s *SondeHubSource) Start(handler PacketHandler) error {
+	client, err := MQTTConnection(s.cfg, func(client mqtt.Client, msg mqtt.Message) {
+		if recorder != nil {
+			recorder.Record(msg.Topic(), msg.Payload())
+		}
+		// Parse the message payload into a SondeHub packet
+		pkts, err := ParseBatch(msg.Payload())
+		if err != nil {
+			fmt.Println("Error parsing packets:", err)
+			return
+		}
+		handler(pkts)
+	})
+	if err != nil {
+		return err
+	}
+	s.client = client
+	if token := s.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (s *SondeHubSource) Stop() {
+	if s.client != nil {
+		s.client.Disconnect(250)
+	}
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The public Nominatim instance allows at most one request per second
+const publicNominatimHost = "nominatim.openstreetmap.org"
+
+// NominatimConfig configures an OpenStreetMap Nominatim server (the public one or self hosted)
+type NominatimConfig struct {
+	URL       string `yaml:"url" env:"NOMINATIM_URL"`
+	UserAgent string `yaml:"user_agent" env:"NOMINATIM_USER_AGENT"`
+}
+
+// PhotonConfig configures a Photon server (e.g. photon.komoot.io or self hosted)
+type PhotonConfig struct {
+	URL string `yaml:"url" env:"PHOTON_URL"`
+}
+
+// NominatimGeocoder is a Geocoder backed by Nominatim's /reverse endpoint
+type NominatimGeocoder struct {
+	cfg      NominatimConfig
+	language string
+
+	// Only used against the public instance, to stay within its usage policy
+	mu       sync.Mutex
+	throttle bool
+	last     time.Time
+}
+
+func NewNominatimGeocoder(cfg NominatimConfig, language string) (*NominatimGeocoder, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid nominatim url %q", cfg.URL)
+	}
+	return &NominatimGeocoder{cfg: cfg, language: language, throttle: u.Host == publicNominatimHost}, nil
+}
+
+func (g *NominatimGeocoder) Name() string {
+	return "nominatim"
+}
+
+func (g *NominatimGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	if g.throttle {
+		g.mu.Lock()
+		if wait := time.Second - time.Since(g.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		g.last = time.Now()
+		g.mu.Unlock()
+	}
+
+	params := url.Values{}
+	params.Set("format", "jsonv2")
+	params.Set("lat", fmt.Sprintf("%f", lat))
+	params.Set("lon", fmt.Sprintf("%f", lon))
+	params.Set("zoom", "12") // Town level, we never show street addresses
+	params.Set("addressdetails", "1")
+	if g.language != "" {
+		params.Set("accept-language", g.language)
+	}
+	req, err := http.NewRequest("GET", strings.TrimRight(g.cfg.URL, "/")+"/reverse?"+params.Encode(), nil)
+	if err != nil {
+		return Place{}, err
+	}
+	req.Header.Set("User-Agent", g.cfg.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Place{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return Place{}, fmt.Errorf("nominatim API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Error   string            `json:"error"`
+		Address map[string]string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Place{}, err
+	}
+	if result.Error != "" {
+		return Place{}, errors.New(result.Error)
+	}
+	addr := result.Address
+	place := Place{
+		City:        firstNonEmpty(addr["city"], addr["town"], addr["village"], addr["hamlet"], addr["municipality"]),
+		County:      strings.TrimSuffix(addr["county"], " County"),
+		State:       firstNonEmpty(addr["state"], addr["region"], addr["state_district"]),
+		Country:     addr["country"],
+		CountryCode: strings.ToUpper(addr["country_code"]),
+	}
+	// ISO3166-2-lvl4 is e.g. US-KS, the subdivision part is the state code
+	if _, code, ok := strings.Cut(addr["ISO3166-2-lvl4"], "-"); ok {
+		place.StateCode = code
+	}
+	if place == (Place{}) {
+		return place, errors.New("no address found")
+	}
+	return place, nil
+}
+
+// PhotonGeocoder is a Geocoder backed by Photon's /reverse endpoint
+type PhotonGeocoder struct {
+	cfg      PhotonConfig
+	language string
+}
+
+func NewPhotonGeocoder(cfg PhotonConfig, language string) (*PhotonGeocoder, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid photon url %q", cfg.URL)
+	}
+	return &PhotonGeocoder{cfg: cfg, language: language}, nil
+}
+
+func (g *PhotonGeocoder) Name() string {
+	return "photon"
+}
+
+func (g *PhotonGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	params := url.Values{}
+	params.Set("lat", fmt.Sprintf("%f", lat))
+	params.Set("lon", fmt.Sprintf("%f", lon))
+	if g.language != "" {
+		params.Set("lang", g.language)
+	}
+	resp, err := http.Get(strings.TrimRight(g.cfg.URL, "/") + "/reverse?" + params.Encode())
+	if err != nil {
+		return Place{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return Place{}, fmt.Errorf("photon API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Features []struct {
+			Properties struct {
+				Name        string `json:"name"`
+				Type        string `json:"type"`
+				City        string `json:"city"`
+				County      string `json:"county"`
+				State       string `json:"state"`
+				Country     string `json:"country"`
+				CountryCode string `json:"countrycode"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Place{}, err
+	}
+	if len(result.Features) == 0 {
+		return Place{}, errors.New("no address found")
+	}
+	props := result.Features[0].Properties
+	place := Place{
+		City:        props.City,
+		County:      strings.TrimSuffix(props.County, " County"),
+		State:       props.State,
+		Country:     props.Country,
+		CountryCode: strings.ToUpper(props.CountryCode),
+	}
+	// The closest feature may be the town itself rather than something in it
+	if place.City == "" && (props.Type == "city" || props.Type == "town" || props.Type == "village") {
+		place.City = props.Name
+	}
+	return place, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
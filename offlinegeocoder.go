@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OfflineGeocoderConfig points at the local datasets used by the offline geocoder
+type OfflineGeocoderConfig struct {
+	// GeoNames places dump (e.g. cities1000.txt or US.txt) for the nearest populated place
+	PlacesFile string `yaml:"places_file" env:"GEOCODER_PLACES_FILE"`
+	// GeoNames admin1CodesASCII.txt, for state/region names outside the US
+	Admin1File string `yaml:"admin1_file" env:"GEOCODER_ADMIN1_FILE"`
+	// GeoJSON files with county/state polygons, e.g. Census cartographic boundary files
+	AreasFiles []string `yaml:"areas_files" env:"GEOCODER_AREAS_FILES"`
+	// Places further away than this are ignored, only the county/state is used
+	MaxPlaceMiles float64 `yaml:"max_place_miles" env:"GEOCODER_MAX_PLACE_MILES"`
+}
+
+// offlinePlace is one populated place from the GeoNames dump
+type offlinePlace struct {
+	name        string
+	lat, lon    float64
+	countryCode string
+	admin1      string
+}
+
+// offlineArea is one county/state polygon and the parts of a Place it fills in
+type offlineArea struct {
+	geometry                       Geometry
+	minLat, maxLat, minLon, maxLon float64
+	place                          Place
+}
+
+// OfflineGeocoder is a Geocoder that only uses local datasets, so it keeps working without any API
+type OfflineGeocoder struct {
+	places        []offlinePlace
+	grid          map[[2]int][]int // 1 degree cells -> indexes into places
+	admin1        map[string]string
+	areas         []offlineArea
+	maxPlaceMiles float64
+}
+
+// NewOfflineGeocoder loads the datasets into memory
+func NewOfflineGeocoder(cfg OfflineGeocoderConfig) (*OfflineGeocoder, error) {
+	if cfg.PlacesFile == "" && len(cfg.AreasFiles) == 0 {
+		return nil, errors.New("offline geocoder needs places_file and/or areas_files")
+	}
+	g := &OfflineGeocoder{
+		grid:          make(map[[2]int][]int),
+		admin1:        make(map[string]string),
+		maxPlaceMiles: cfg.MaxPlaceMiles,
+	}
+	if cfg.PlacesFile != "" {
+		if err := g.loadPlaces(cfg.PlacesFile); err != nil {
+			return nil, fmt.Errorf("failed to load places_file: %w", err)
+		}
+	}
+	if cfg.Admin1File != "" {
+		if err := g.loadAdmin1(cfg.Admin1File); err != nil {
+			return nil, fmt.Errorf("failed to load admin1_file: %w", err)
+		}
+	}
+	for _, file := range cfg.AreasFiles {
+		if err := g.loadAreas(file); err != nil {
+			return nil, fmt.Errorf("failed to load areas file %s: %w", file, err)
+		}
+	}
+	return g, nil
+}
+
+func (g *OfflineGeocoder) Name() string {
+	return "offline"
+}
+
+// loadPlaces reads the populated places (feature class P) from a GeoNames tab separated dump
+func (g *OfflineGeocoder) loadPlaces(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 11 || cols[6] != "P" {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(cols[4], 64)
+		lon, err2 := strconv.ParseFloat(cols[5], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		g.grid[gridCell(lat, lon)] = append(g.grid[gridCell(lat, lon)], len(g.places))
+		g.places = append(g.places, offlinePlace{
+			name:        cols[1],
+			lat:         lat,
+			lon:         lon,
+			countryCode: cols[8],
+			admin1:      cols[10],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(g.places) == 0 {
+		return errors.New("no populated places found")
+	}
+	return nil
+}
+
+// loadAdmin1 reads GeoNames admin1 names, keyed by <country code>.<admin1 code>
+func (g *OfflineGeocoder) loadAdmin1(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) >= 2 {
+			g.admin1[cols[0]] = cols[1]
+		}
+	}
+	return scanner.Err()
+}
+
+// loadAreas reads county/state polygons. Properties are read from generic keys (county, state, state_code,
+// country, country_code) or the Census cartographic boundary file keys (NAME, STUSPS, STATE_NAME).
+func (g *OfflineGeocoder) loadAreas(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	features, err := ParseGeoJSONFeatures(data)
+	if err != nil {
+		return err
+	}
+	for i, feature := range features {
+		// One broken shape shouldn't take the whole geocoder down
+		if err := feature.Geometry.validate(); err != nil {
+			fmt.Printf("Skipping feature %d of %s: %v\n", i+1, filename, err)
+			continue
+		}
+		props := feature.Properties
+		place := Place{
+			County:      propString(props, "county"),
+			State:       defaultString(propString(props, "state"), propString(props, "STATE_NAME")),
+			StateCode:   defaultString(propString(props, "state_code"), propString(props, "STUSPS")),
+			Country:     propString(props, "country"),
+			CountryCode: propString(props, "country_code"),
+		}
+		// Census county files have a COUNTYFP, state files don't, and NAME is the county or state accordingly
+		if name := propString(props, "NAME"); name != "" {
+			if _, isCounty := props["COUNTYFP"]; isCounty {
+				place.County = defaultString(place.County, name)
+			} else {
+				place.State = defaultString(place.State, name)
+			}
+		}
+		if place.StateCode != "" && place.CountryCode == "" {
+			place.CountryCode = "US"
+		}
+		g.areas = append(g.areas, newOfflineArea(feature.Geometry, place))
+	}
+	return nil
+}
+
+func propString(props map[string]any, key string) string {
+	if v, ok := props[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func newOfflineArea(geometry Geometry, place Place) offlineArea {
+	a := offlineArea{geometry: geometry, place: place, minLat: 90, maxLat: -90, minLon: math.Inf(1), maxLon: math.Inf(-1)}
+	for _, poly := range geometry {
+		for _, pt := range poly[0] {
+			a.minLon, a.maxLon = math.Min(a.minLon, pt[0]), math.Max(a.maxLon, pt[0])
+			a.minLat, a.maxLat = math.Min(a.minLat, pt[1]), math.Max(a.maxLat, pt[1])
+		}
+	}
+	return a
+}
+
+// contains checks the bounding box first, since most areas are nowhere near the point
+func (a *offlineArea) contains(lat, lon float64) bool {
+	if lat < a.minLat || lat > a.maxLat {
+		return false
+	}
+	for _, shift := range []float64{0, 360, -360} {
+		if lon+shift >= a.minLon && lon+shift <= a.maxLon {
+			return a.geometry.Contains(lat, lon)
+		}
+	}
+	return false
+}
+
+func gridCell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+}
+
+// nearestPlace searches the grid cells around the point that could hold a place within maxMiles
+func (g *OfflineGeocoder) nearestPlace(lat, lon, maxMiles float64) (offlinePlace, float64, bool) {
+	cell := gridCell(lat, lon)
+	dLat := int(math.Ceil(maxMiles / milesPerDegree))
+	dLon := 180
+	if lonMiles := milesPerDegree * math.Cos(lat*math.Pi/180); lonMiles > 0 {
+		dLon = min(180, int(math.Ceil(maxMiles/lonMiles)))
+	}
+
+	best, bestDist, found := offlinePlace{}, math.Inf(1), false
+	for y := cell[0] - dLat; y <= cell[0]+dLat; y++ {
+		for x := cell[1] - dLon; x <= cell[1]+dLon; x++ {
+			// Wrap the cell around the antimeridian
+			wrapped := ((x+180)%360+360)%360 - 180
+			for _, i := range g.grid[[2]int{y, wrapped}] {
+				p := g.places[i]
+				if d := haversineMiles(lat, lon, p.lat, p.lon); d < bestDist {
+					best, bestDist, found = p, d, true
+				}
+			}
+		}
+	}
+	return best, bestDist, found && bestDist <= maxMiles
+}
+
+func (g *OfflineGeocoder) ReverseGeocode(lat, lon float64) (Place, error) {
+	var place Place
+	for i := range g.areas {
+		if g.areas[i].contains(lat, lon) {
+			place = mergePlace(place, g.areas[i].place)
+		}
+	}
+
+	if p, _, ok := g.nearestPlace(lat, lon, g.maxPlaceMiles); ok {
+		place.City = p.name
+		place.CountryCode = defaultString(place.CountryCode, p.countryCode)
+		// GeoNames uses the state abbreviation as the admin1 code in the US only
+		if p.countryCode == "US" {
+			place.StateCode = defaultString(place.StateCode, p.admin1)
+		}
+		place.State = defaultString(place.State, g.admin1[p.countryCode+"."+p.admin1])
+	}
+
+	if place == (Place{}) {
+		return place, fmt.Errorf("no place found within %.0f miles", g.maxPlaceMiles)
+	}
+	return place, nil
+}
+
+// mergePlace fills in the empty fields of a from b
+func mergePlace(a, b Place) Place {
+	a.City = defaultString(a.City, b.City)
+	a.County = defaultString(a.County, b.County)
+	a.State = defaultString(a.State, b.State)
+	a.StateCode = defaultString(a.StateCode, b.StateCode)
+	a.Country = defaultString(a.Country, b.Country)
+	a.CountryCode = defaultString(a.CountryCode, b.CountryCode)
+	return a
+}
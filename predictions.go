@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How often every SondeHub prediction is refetched, in seconds
+const predictionRefreshInterval = 5 * 60
+
+// predictionCache keeps the latest landing prediction of every sonde, so zones can be matched against
+// predicted landing points without a SondeHub request per packet
+type predictionCache struct {
+	mu    sync.RWMutex
+	preds map[string]*SHPredictionResult
+	fresh map[string]bool // Serials Set since the last refresh
+}
+
+var predictions = &predictionCache{
+	preds: make(map[string]*SHPredictionResult),
+	fresh: make(map[string]bool),
+}
+
+// Get returns the cached prediction for a serial, or nil
+func (c *predictionCache) Get(serial string) *SHPredictionResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.preds[serial]
+}
+
+// Set stores a fresher prediction for one serial, e.g. one fetched for a regular update
+func (c *predictionCache) Set(serial string, pred *SHPredictionResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.preds[serial] = pred
+	c.fresh[serial] = true
+}
+
+// merge stores the predictions of a refresh and drops sondes missing from it. Anything Set since the last
+// refresh is kept as it is, it is at least as recent as the bulk prediction.
+func (c *predictionCache) merge(preds map[string]*SHPredictionResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for serial := range c.preds {
+		if _, ok := preds[serial]; !ok && !c.fresh[serial] {
+			delete(c.preds, serial)
+		}
+	}
+	for serial, pred := range preds {
+		if !c.fresh[serial] {
+			c.preds[serial] = pred
+		}
+	}
+	c.fresh = make(map[string]bool)
+}
+
+// Routine to periodically refresh the prediction cache with a single request for every sonde
+func startPredictionUpdater() {
+	go func() {
+		for {
+			updated, err := GetAllPredictions()
+			if err != nil {
+				fmt.Println("Error updating predictions:", err)
+			} else {
+				predictions.merge(updated)
+			}
+			time.Sleep(time.Duration(predictionRefreshInterval) * time.Second)
+		}
+	}()
+}
+
+// watchedSonde is a sonde outside every region, waiting for its prediction to be checked
+type watchedSonde struct {
+	pkt         SHPacket
+	lastSeen    int64
+	lastChecked int64
+}
+
+var (
+	watchedSondes   = make(map[string]*watchedSonde)
+	watchedSondesMu sync.Mutex
+)
+
+// watchSonde remembers a sonde outside every region if it is close enough to one to drift into it
+func watchSonde(pkt SHPacket, now int64) {
+	watchedSondesMu.Lock()
+	w, ok := watchedSondes[pkt.Serial]
+	if ok {
+		w.pkt = pkt
+		w.lastSeen = now
+	}
+	watchedSondesMu.Unlock()
+	if ok || nearestRegionMiles(pkt.Lat, pkt.Lon) > currentConfig().PredictionTracking.MaxDistanceMiles {
+		return
+	}
+
+	watchedSondesMu.Lock()
+	defer watchedSondesMu.Unlock()
+	watchedSondes[pkt.Serial] = &watchedSonde{pkt: pkt, lastSeen: now}
+}
+
+func unwatchSonde(serial string) {
+	watchedSondesMu.Lock()
+	defer watchedSondesMu.Unlock()
+	delete(watchedSondes, serial)
+}
+
+// checkWatchedSondes fetches predictions for watched sondes that are due, within the rate limit,
+// and starts tracking any whose predicted path crosses a region
+func checkWatchedSondes(now int64) {
+	cfg := currentConfig()
+	var due []SHPacket
+	watchedSondesMu.Lock()
+	for serial, w := range watchedSondes {
+		if now-w.lastSeen > cfg.LostSignalTimeout {
+			delete(watchedSondes, serial)
+			continue
+		}
+		if now-w.lastChecked < cfg.PredictionTracking.CheckInterval || len(due) >= cfg.PredictionTracking.MaxChecksPerMinute {
+			continue
+		}
+		w.lastChecked = now
+		due = append(due, w.pkt)
+	}
+	watchedSondesMu.Unlock()
+
+	for _, pkt := range due {
+		checkWatchedSonde(pkt, cfg.PredictionTracking.MaxDistanceMiles)
+	}
+}
+
+func checkWatchedSonde(pkt SHPacket, maxDistance float64) {
+	// It may have drifted away from every region since it was first seen
+	if nearestRegionMiles(pkt.Lat, pkt.Lon) > maxDistance {
+		unwatchSonde(pkt.Serial)
+		return
+	}
+
+	pred, err := GetPrediction(pkt.Serial)
+	if err != nil {
+		fmt.Println("Error getting prediction:", err)
+		return
+	}
+	predictions.Set(pkt.Serial, pred)
+	matched := MatchPredictedPath(pred)
+	if len(matched) == 0 {
+		return
+	}
+
+	if !claimSonde(pkt.Serial) {
+		return
+	}
+	defer releaseSonde(pkt.Serial)
+	unwatchSonde(pkt.Serial)
+
+	session, err := redisclient.GetSondeSession(pkt.Serial)
+	if err != nil {
+		fmt.Println("Error getting SondeSession from Redis:", err)
+		return
+	}
+	if session != nil {
+		// Already tracked
+		return
+	}
+	fmt.Printf("%s is predicted to drift into %d region(s)\n", pkt.Serial, len(matched))
+	handleNewSonde(pkt, matched)
+}
+
+// startPredictionWatcher checks watched sondes every minute while prediction tracking is enabled
+func startPredictionWatcher() {
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			if currentConfig().PredictionTracking.Enabled {
+				checkWatchedSondes(clock.Now().UTC().Unix())
+			}
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestPredictionCacheMerge(t *testing.T) {
+	c := &predictionCache{preds: make(map[string]*SHPredictionResult), fresh: make(map[string]bool)}
+	c.merge(map[string]*SHPredictionResult{
+		"S1": {Latitude: 1},
+		"S2": {Latitude: 2},
+	})
+	c.Set("S3", &SHPredictionResult{Latitude: 3})
+	c.Set("S2", &SHPredictionResult{Latitude: 22})
+
+	// S1 is gone from SondeHub, S2 and S3 were Set since the last refresh
+	c.merge(map[string]*SHPredictionResult{
+		"S2": {Latitude: 20},
+		"S4": {Latitude: 4},
+	})
+	if c.Get("S1") != nil {
+		t.Error("S1 was kept after it dropped out of the refresh")
+	}
+	if p := c.Get("S2"); p == nil || p.Latitude != 22 {
+		t.Errorf("S2 = %+v, want the prediction that was Set", p)
+	}
+	if c.Get("S3") == nil {
+		t.Error("S3 was dropped even though it was Set since the last refresh")
+	}
+	if p := c.Get("S4"); p == nil || p.Latitude != 4 {
+		t.Errorf("S4 = %+v, want the refreshed prediction", p)
+	}
+
+	// Without another Set, the next refresh decides again
+	c.merge(map[string]*SHPredictionResult{"S2": {Latitude: 20}})
+	if c.Get("S3") != nil {
+		t.Error("S3 was kept a second refresh after it was Set")
+	}
+	if p := c.Get("S2"); p == nil || p.Latitude != 20 {
+		t.Errorf("S2 = %+v, want the refreshed prediction", p)
+	}
+}
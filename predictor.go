@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// The local predictor flies the sonde down through the winds it measured on the way up, with the
+// descent rate seen so far scaled by air density. It is a fallback for when SondeHub has no prediction.
+const (
+	// Altitude band (m) the ascent winds are averaged over
+	windBinMeters = 500
+	// Integration step in seconds
+	predictorStep = 10
+	// Seconds between points of the predicted path
+	predictorPathInterval = 60
+	// Only the last few minutes of the track are used for the current ascent/descent rate
+	recentTrackSeconds = 300
+	// Used when there is nothing better to go on
+	defaultAscentRate    = 5.0   // m/s
+	defaultDescentRate   = 5.0   // m/s at sea level
+	defaultBurstAltitude = 30000 // m
+	// Launch sites higher than this are unusual, a first point above it was heard mid flight
+	maxGroundAltitude = 3000
+	// Give up on flights that don't come down within this time
+	maxPredictorSeconds = 8 * 60 * 60
+	metersPerDegree     = milesPerDegree * 1609.344
+)
+
+// standardAtmosphere returns the International Standard Atmosphere temperature (K) and pressure (Pa)
+// at an altitude in meters
+func standardAtmosphere(alt float64) (temp, pressure float64) {
+	switch {
+	case alt < 11000:
+		temp = 288.15 - 0.0065*alt
+		pressure = 101325 * math.Pow(temp/288.15, 5.25588)
+	case alt < 20000:
+		temp = 216.65
+		pressure = 22632.1 * math.Exp(-0.000157688*(alt-11000))
+	default:
+		temp = 216.65 + 0.001*(alt-20000)
+		pressure = 5474.89 * math.Pow(216.65/temp, 34.1632)
+	}
+	return temp, pressure
+}
+
+// airDensity returns the International Standard Atmosphere air density (kg/m³) at an altitude in meters
+func airDensity(alt float64) float64 {
+	temp, pressure := standardAtmosphere(alt)
+	return pressure / (287.053 * temp)
+}
+
+// Sea level air density, the descent rates below are normalized to it
+var seaLevelDensity = airDensity(0)
+
+// descentRateAt scales a sea level descent rate to an altitude. Drag balances weight, so the
+// terminal velocity goes with the inverse square root of the air density.
+func descentRateAt(seaLevelRate, alt float64) float64 {
+	return seaLevelRate * math.Sqrt(seaLevelDensity/airDensity(alt))
+}
+
+// windProfile is the horizontal drift (m/s east and north) by altitude band
+type windProfile struct {
+	alts        []float64
+	east, north []float64
+}
+
+// drift returns the east and north velocity (m/s) between two track points
+func drift(a, b TrackPoint) (east, north float64) {
+	dt := float64(b.Time - a.Time)
+	north = (b.Lat - a.Lat) * metersPerDegree / dt
+	east = wrapLongitude(b.Lon-a.Lon) * metersPerDegree * math.Cos((a.Lat+b.Lat)/2*math.Pi/180) / dt
+	return east, north
+}
+
+// newWindProfile averages the drift between consecutive ascending track points into altitude bands
+func newWindProfile(track []TrackPoint) windProfile {
+	type bin struct {
+		east, north float64
+		n           int
+	}
+	bins := make(map[int]*bin)
+	for i := 1; i < len(track); i++ {
+		a, b := track[i-1], track[i]
+		if b.Time <= a.Time || b.Alt <= a.Alt {
+			continue
+		}
+		east, north := drift(a, b)
+		key := int((a.Alt + b.Alt) / 2 / windBinMeters)
+		if bins[key] == nil {
+			bins[key] = &bin{}
+		}
+		bins[key].east += east
+		bins[key].north += north
+		bins[key].n++
+	}
+
+	keys := make([]int, 0, len(bins))
+	for key := range bins {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	var w windProfile
+	for _, key := range keys {
+		b := bins[key]
+		w.alts = append(w.alts, (float64(key)+0.5)*windBinMeters)
+		w.east = append(w.east, b.east/float64(b.n))
+		w.north = append(w.north, b.north/float64(b.n))
+	}
+	return w
+}
+
+// at interpolates the wind at an altitude, holding the nearest band's wind outside the measured range
+func (w windProfile) at(alt float64) (east, north float64) {
+	n := len(w.alts)
+	i := sort.SearchFloat64s(w.alts, alt)
+	switch {
+	case i == 0:
+		return w.east[0], w.north[0]
+	case i == n:
+		return w.east[n-1], w.north[n-1]
+	}
+	f := (alt - w.alts[i-1]) / (w.alts[i] - w.alts[i-1])
+	return w.east[i-1] + f*(w.east[i]-w.east[i-1]), w.north[i-1] + f*(w.north[i]-w.north[i-1])
+}
+
+// recentRate averages the vertical speed (m/s, positive up) over the last few minutes of the track,
+// normalized to sea level density when seaLevel is set. ok is false if the track has no usable points.
+func recentRate(track []TrackPoint, up, seaLevel bool) (float64, bool) {
+	if len(track) < 2 {
+		return 0, false
+	}
+	since := track[len(track)-1].Time - recentTrackSeconds
+	var sum float64
+	var n int
+	for i := len(track) - 1; i > 0 && track[i-1].Time >= since; i-- {
+		a, b := track[i-1], track[i]
+		if b.Time <= a.Time || (b.Alt > a.Alt) != up {
+			continue
+		}
+		rate := math.Abs(b.Alt-a.Alt) / float64(b.Time-a.Time)
+		if seaLevel {
+			rate *= math.Sqrt(airDensity((a.Alt+b.Alt)/2) / seaLevelDensity)
+		}
+		sum += rate
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// LocalPrediction predicts the landing point from the sonde's track. The result looks like a
+// SondeHub prediction (with Local set), so it can be shown and rendered the same way.
+func LocalPrediction(pkt SHPacket, session *SondeSession, track []TrackPoint) (*SHPredictionResult, error) {
+	if len(track) < 2 {
+		return nil, errors.New("not enough track for a local prediction")
+	}
+
+	// The winds on the way down are assumed to be the ones measured on the way up
+	ascent := track
+	if session.MaxAltTime != 0 {
+		for i, pt := range track {
+			if pt.Time > session.MaxAltTime {
+				ascent = track[:i]
+				break
+			}
+		}
+	}
+	wind := newWindProfile(ascent)
+	if len(wind.alts) == 0 {
+		// Heard only after the burst, so all we have is the current drift
+		heading := pkt.Heading * math.Pi / 180
+		wind = windProfile{
+			alts:  []float64{pkt.Alt},
+			east:  []float64{pkt.VelH * math.Sin(heading)},
+			north: []float64{pkt.VelH * math.Cos(heading)},
+		}
+	}
+
+	// A track that starts low and climbing was heard from launch, so it starts at ground level
+	ground := 0.0
+	if track[0].Alt < maxGroundAltitude && track[1].Alt > track[0].Alt {
+		ground = track[0].Alt
+	}
+
+	descending := session.Phase == PhaseBurst || session.Phase == PhaseDescent || pkt.VelV < 0
+	ascentRate, ok := recentRate(track, true, false)
+	if !ok {
+		ascentRate = defaultAscentRate
+	}
+	// Before the burst there is no descent to measure, GPS noise at the top doesn't count
+	descentRate, ok := recentRate(track, false, true)
+	if !descending || !ok {
+		descentRate = defaultDescentRate
+		if pkt.VelV < 0 {
+			descentRate = -pkt.VelV * math.Sqrt(airDensity(pkt.Alt)/seaLevelDensity)
+		}
+	}
+	burstAlt := session.PredBurstAlt
+	if burstAlt <= 0 {
+		burstAlt = defaultBurstAltitude
+	}
+
+	pred := &SHPredictionResult{
+		Vehicle:       pkt.Serial,
+		AscentRate:    ascentRate,
+		DescentRate:   descentRate,
+		BurstAltitude: math.Max(burstAlt, session.MaxAlt),
+		Local:         true,
+	}
+	if descending {
+		pred.Descending = 1
+	}
+
+	last := track[len(track)-1]
+	lat, lon, alt := pkt.Lat, pkt.Lon, pkt.Alt
+	t := float64(last.Time)
+	pred.Path = append(pred.Path, PredictionPoint{Lat: lat, Lon: lon, Alt: alt, Time: t})
+	for step := 0; alt > ground; step++ {
+		if step*predictorStep > maxPredictorSeconds {
+			return nil, errors.New("local prediction did not come down")
+		}
+		if !descending && alt >= burstAlt {
+			descending = true
+		}
+		if descending {
+			alt -= descentRateAt(descentRate, alt) * predictorStep
+		} else {
+			alt += ascentRate * predictorStep
+		}
+		east, north := wind.at(alt)
+		lat += north * predictorStep / metersPerDegree
+		lon = wrapLongitude(lon + east*predictorStep/(metersPerDegree*math.Cos(lat*math.Pi/180)))
+		t += predictorStep
+		if alt <= ground || (step+1)*predictorStep%predictorPathInterval == 0 {
+			pred.Path = append(pred.Path, PredictionPoint{Lat: lat, Lon: lon, Alt: math.Max(alt, ground), Time: t})
+		}
+	}
+
+	end := pred.Path[len(pred.Path)-1]
+	pred.Latitude = end.Lat
+	pred.Longitude = end.Lon
+	pred.Altitude = end.Alt
+	pred.Time = time.Unix(int64(end.Time), 0).UTC()
+	// The map renderer draws the path from Data, like it does for SondeHub's predictions
+	data, err := json.Marshal(pred.Path)
+	if err != nil {
+		return nil, err
+	}
+	pred.Data = string(data)
+	return pred, nil
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 )
 
 type RadarGeoResponse struct {
@@ -71,9 +70,9 @@ type RadarDistanceResponse struct {
 // RadarReverseGeocode calls Radar.io reverse geocode API and returns RadarGeoResponse
 func RadarReverseGeocode(lat, lon float64) (RadarGeoResponse, error) {
 	var respObj RadarGeoResponse
-	apiKey := os.Getenv("RADAR_API_KEY")
+	apiKey := currentConfig().RadarAPIKey
 	if apiKey == "" {
-		return respObj, fmt.Errorf("RADAR_API_KEY not set in environment")
+		return respObj, fmt.Errorf("radar_api_key not configured")
 	}
 	url := fmt.Sprintf("https://api.radar.io/v1/geocode/reverse?coordinates=%f,%f&layers=", lat, lon)
 	req, err := http.NewRequest("GET", url, nil)
@@ -106,9 +105,9 @@ func RadarDistanceCalc(origin, destination []float64) (RadarDistanceResponse, er
 	if len(origin) != 2 || len(destination) != 2 {
 		return respObj, fmt.Errorf("origin and destination must be [lat,lon]")
 	}
-	apiKey := os.Getenv("RADAR_API_KEY")
+	apiKey := currentConfig().RadarAPIKey
 	if apiKey == "" {
-		return respObj, fmt.Errorf("RADAR_API_KEY not set in environment")
+		return respObj, fmt.Errorf("radar_api_key not configured")
 	}
 	url := fmt.Sprintf("https://api.radar.io/v1/route/distance?origin=%f,%f&destination=%f,%f&modes=car&units=imperial", origin[0], origin[1], destination[0], destination[1])
 	req, err := http.NewRequest("GET", url, nil)
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"os"
+	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
@@ -11,30 +12,51 @@ import (
 )
 
 type SondeSession struct {
-	Time     int64  `json:"time"`
-	Webhook  string `json:"webhook"`
-	FromText string `json:"fromText"`
-	IMetAlt  int    `json:"iMetAlt,omitempty"` // Altitude in meters
+	Regions   map[string]*RegionMessage `json:"regions,omitempty"` // Discord message per region name
+	FromText  string                    `json:"fromText"`
+	IMetAlt   int                       `json:"iMetAlt,omitempty"` // Altitude in meters
+	SondeType string                    `json:"type,omitempty"`    // Subtype or type, used to rebuild embed titles
+	FirstSeen int64                     `json:"firstSeen,omitempty"`
+	LaunchLat float64                   `json:"launchLat,omitempty"` // Launch site, or where we first heard the sonde
+	LaunchLon float64                   `json:"launchLon,omitempty"`
+
+	// Flight phase tracking, see flightphase.go
+	Phase         FlightPhase `json:"phase,omitempty"`
+	PhaseTime     int64       `json:"phaseTime,omitempty"`
+	DescentFrames int         `json:"descentFrames,omitempty"`
+	StillFrames   int         `json:"stillFrames,omitempty"`
+	LastSeen      int64       `json:"lastSeen,omitempty"`
+	LastFrame     int         `json:"lastFrame,omitempty"`
+	LastLat       float64     `json:"lastLat,omitempty"`
+	LastLon       float64     `json:"lastLon,omitempty"`
+	LastAlt       float64     `json:"lastAlt,omitempty"` // Altitude in meters
+	MaxAlt        float64     `json:"maxAlt,omitempty"`  // Altitude in meters
+	MaxAltLat     float64     `json:"maxAltLat,omitempty"`
+	MaxAltLon     float64     `json:"maxAltLon,omitempty"`
+	MaxAltTime    int64       `json:"maxAltTime,omitempty"`
+	PredBurstAlt  float64     `json:"predBurstAlt,omitempty"` // SondeHub's predicted burst altitude in meters, from before the burst
+
+	ChaseNotified []string `json:"chaseNotified,omitempty"` // Chase team members already notified, see chaseteam.go
+	HistoryTime   int64    `json:"historyTime,omitempty"`   // When the last packet was added to the history, see history.go
 }
 
-// NewRedisClient creates a RedisMgr using environment variables, defaults to localhost:6379 if not set.
-func NewRedisClient() *RedisMgr {
-	addr := os.Getenv("REDIS_ADDR")
-	if addr == "" {
-		addr = "localhost:6379"
-	}
-	password := os.Getenv("REDIS_PASSWORD")
-	db := 0
-	if dbStr := os.Getenv("REDIS_DB"); dbStr != "" {
-		// Optionally parse db from env
-		if parsed, err := strconv.Atoi(dbStr); err == nil {
-			db = parsed
-		}
-	}
+// Redis set holding the serials of every sonde that is still in flight
+const activeSondesKey = "balloony:active"
+
+// Redis hash of chase team members, keyed by name
+const chaseTeamKey = "balloony:chase"
+
+// Redis stream of a sonde's telemetry history, see history.go
+func historyKey(serial string) string {
+	return "balloony:history:" + serial
+}
+
+// NewRedisClient creates a RedisMgr from the redis section of the configuration.
+func NewRedisClient(cfg RedisConfig) *RedisMgr {
 	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password, // empty string means no password
-		DB:       db,       // use default DB
+		Addr:     cfg.Addr,
+		Password: cfg.Password, // empty string means no password
+		DB:       cfg.DB,       // use default DB
 	})
 	return &RedisMgr{Client: client}
 }
@@ -59,6 +81,16 @@ func (mgr *RedisMgr) GetSondeSession(serial string) (*SondeSession, error) {
 	if err := json.Unmarshal([]byte(data), &session); err != nil {
 		return nil, err
 	}
+	// Sessions saved before regions existed only had a single webhook message
+	var legacy struct {
+		Time    int64  `json:"time"`
+		Webhook string `json:"webhook"`
+	}
+	if len(session.Regions) == 0 && json.Unmarshal([]byte(data), &legacy) == nil && legacy.Webhook != "" {
+		session.Regions = map[string]*RegionMessage{
+			defaultRegionName: {Webhook: legacy.Webhook, Time: legacy.Time},
+		}
+	}
 	return &session, nil
 }
 
@@ -72,6 +104,30 @@ func (mgr *RedisMgr) SaveSondeSession(serial string, session *SondeSession) erro
 	return mgr.Client.Set(ctx, serial, data, 8*60*60*1e9).Err() // 8 hours in nanoseconds
 }
 
+// TrackActiveSonde adds a serial to the set of sondes checked for lost signal.
+func (mgr *RedisMgr) TrackActiveSonde(serial string) error {
+	ctx := context.Background()
+	return mgr.Client.SAdd(ctx, activeSondesKey, serial).Err()
+}
+
+// UntrackActiveSonde removes a serial from the set of active sondes.
+func (mgr *RedisMgr) UntrackActiveSonde(serial string) error {
+	ctx := context.Background()
+	return mgr.Client.SRem(ctx, activeSondesKey, serial).Err()
+}
+
+// IsActiveSonde returns true if the serial is in the set of active sondes.
+func (mgr *RedisMgr) IsActiveSonde(serial string) (bool, error) {
+	ctx := context.Background()
+	return mgr.Client.SIsMember(ctx, activeSondesKey, serial).Result()
+}
+
+// ActiveSondes returns the serials of every sonde still in flight.
+func (mgr *RedisMgr) ActiveSondes() ([]string, error) {
+	ctx := context.Background()
+	return mgr.Client.SMembers(ctx, activeSondesKey).Result()
+}
+
 // Ping checks if the Redis connection is alive.
 func (mgr *RedisMgr) Ping() error {
 	ctx := context.Background()
@@ -91,5 +147,108 @@ func (mgr *RedisMgr) GetRaw(ctx context.Context, key string) ([]byte, error) {
 
 // SetRaw sets raw bytes in Redis for a given key with a TTL of 24 hours.
 func (mgr *RedisMgr) SetRaw(ctx context.Context, key string, value []byte) error {
-	return mgr.Client.Set(ctx, key, value, 24*time.Hour).Err()
+	return mgr.SetRawTTL(ctx, key, value, 24*time.Hour)
+}
+
+// SetRawTTL sets raw bytes in Redis for a given key with the given TTL.
+func (mgr *RedisMgr) SetRawTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return mgr.Client.Set(ctx, key, value, ttl).Err()
+}
+
+// IncrStat increments a counter in a stats hash, shared by every instance using the same Redis.
+func (mgr *RedisMgr) IncrStat(ctx context.Context, key, field string) error {
+	return mgr.Client.HIncrBy(ctx, key, field, 1).Err()
+}
+
+// IncrDailyCounter increments a counter that expires after two days, for per-day budgets.
+func (mgr *RedisMgr) IncrDailyCounter(ctx context.Context, key string) (int64, error) {
+	count, err := mgr.Client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		mgr.Client.Expire(ctx, key, 48*time.Hour)
+	}
+	return count, nil
+}
+
+// GetStats returns every counter in a stats hash.
+func (mgr *RedisMgr) GetStats(ctx context.Context, key string) (map[string]string, error) {
+	return mgr.Client.HGetAll(ctx, key).Result()
+}
+
+// SaveChaseMember adds or replaces a chase team member.
+func (mgr *RedisMgr) SaveChaseMember(member ChaseMember) error {
+	ctx := context.Background()
+	data, err := json.Marshal(member)
+	if err != nil {
+		return err
+	}
+	return mgr.Client.HSet(ctx, chaseTeamKey, member.Name, data).Err()
+}
+
+// RemoveChaseMember removes a chase team member, returning false if there was none by that name.
+func (mgr *RedisMgr) RemoveChaseMember(name string) (bool, error) {
+	ctx := context.Background()
+	n, err := mgr.Client.HDel(ctx, chaseTeamKey, name).Result()
+	return n > 0, err
+}
+
+// ChaseMembers returns every chase team member, sorted by name.
+func (mgr *RedisMgr) ChaseMembers() ([]ChaseMember, error) {
+	ctx := context.Background()
+	all, err := mgr.Client.HGetAll(ctx, chaseTeamKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ChaseMember, 0, len(all))
+	for name, data := range all {
+		var member ChaseMember
+		if err := json.Unmarshal([]byte(data), &member); err != nil {
+			return nil, fmt.Errorf("chase team member %s: %w", name, err)
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// AppendHistory adds a packet to a sonde's history stream, which expires retention seconds after the last one.
+func (mgr *RedisMgr) AppendHistory(ctx context.Context, serial string, t int64, pkt SHPacket, retention int64) error {
+	data, err := json.Marshal(pkt)
+	if err != nil {
+		return err
+	}
+	key := historyKey(serial)
+	pipe := mgr.Client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		Values: map[string]any{"t": t, "pkt": data},
+	})
+	pipe.Expire(ctx, key, time.Duration(retention)*time.Second)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// History returns every packet in a sonde's history stream, oldest first.
+func (mgr *RedisMgr) History(ctx context.Context, serial string) ([]HistoryEntry, error) {
+	msgs, err := mgr.Client.XRange(ctx, historyKey(serial), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]HistoryEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		var entry HistoryEntry
+		t, _ := msg.Values["t"].(string)
+		data, _ := msg.Values["pkt"].(string)
+		entry.Time, err = strconv.ParseInt(t, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("history entry %s: bad time %q", msg.ID, t)
+		}
+		if err := json.Unmarshal([]byte(data), &entry.Packet); err != nil {
+			return nil, fmt.Errorf("history entry %s: %w", msg.ID, err)
+		}
+		history = append(history, entry)
+	}
+	return history, nil
 }
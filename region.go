@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// Name of the region built from the top level (single region) settings
+const defaultRegionName = "default"
+
+// Region is a named alert area with its own Discord webhook and presentation settings
+type Region struct {
+	Name           string      `json:"name" yaml:"name"`
+	Bounds         [][]float64 `json:"bounds,omitempty" yaml:"bounds"`               // [lon, lat] pairs, same format as ALERT_BOUNDS
+	BoundaryFile   string      `json:"boundary_file,omitempty" yaml:"boundary_file"` // GeoJSON or KML file, instead of bounds
+	Center         []float64   `json:"center,omitempty" yaml:"center"`               // [lon, lat], with radius_miles
+	RadiusMiles    float64     `json:"radius_miles,omitempty" yaml:"radius_miles"`
+	Corridor       [][]float64 `json:"corridor,omitempty" yaml:"corridor"` // [lon, lat] polyline, with corridor_miles
+	CorridorMiles  float64     `json:"corridor_miles,omitempty" yaml:"corridor_miles"`
+	Webhook        string      `json:"webhook" yaml:"webhook"`
+	Timezone       string      `json:"timezone,omitempty" yaml:"timezone"`
+	MessageUsual   string      `json:"message_usual,omitempty" yaml:"message_usual"`
+	MessageUnusual string      `json:"message_unusual,omitempty" yaml:"message_unusual"`
+	MessageDrift   string      `json:"message_drift,omitempty" yaml:"message_drift"`
+	UpdateInterval int64       `json:"update_interval,omitempty" yaml:"update_interval"` // Seconds
+	MapProfile     string      `json:"map_profile,omitempty" yaml:"map_profile"`         // Name of a map.profiles entry
+
+	location *time.Location
+	zone     Zone
+}
+
+// RegionMessage is the Discord message posted for a sonde in one region
+type RegionMessage struct {
+	Webhook string `json:"webhook"` // Message URL (<webhook>/messages/<id>)
+	Time    int64  `json:"time"`    // Last time the message was updated
+}
+
+// fieldError is a problem with one field of a region or map profile
+type fieldError struct {
+	field string
+	msg   string
+}
+
+// Contains returns true if the point is inside the region's area
+func (r *Region) Contains(lat, lon float64) bool {
+	return r.zone != nil && r.zone.Contains(lat, lon)
+}
+
+// DistanceMiles returns how far the point is outside the region's area, 0 if it is inside
+func (r *Region) DistanceMiles(lat, lon float64) float64 {
+	if r.zone == nil {
+		return math.Inf(1)
+	}
+	return r.zone.DistanceMiles(lat, lon)
+}
+
+// Location returns the region's timezone, falling back to UTC
+func (r *Region) Location() *time.Location {
+	if r.location == nil {
+		return time.UTC
+	}
+	return r.location
+}
+
+// validate fills in defaults and returns every problem that makes the region unusable
+func (r *Region) validate(defaults Region) []fieldError {
+	var errs []fieldError
+	if r.Name == "" {
+		errs = append(errs, fieldError{"name", "is required"})
+	}
+	errs = append(errs, r.buildZone()...)
+	r.Webhook = defaultString(r.Webhook, defaults.Webhook)
+	if r.Webhook == "" {
+		errs = append(errs, fieldError{"webhook", "is required"})
+	}
+	r.Timezone = defaultString(r.Timezone, defaultString(defaults.Timezone, "Etc/UTC"))
+	r.MessageUsual = defaultString(r.MessageUsual, defaults.MessageUsual)
+	r.MessageUnusual = defaultString(r.MessageUnusual, defaults.MessageUnusual)
+	r.MessageDrift = defaultString(r.MessageDrift, defaults.MessageDrift)
+	r.MapProfile = defaultString(r.MapProfile, defaults.MapProfile)
+	if r.UpdateInterval == 0 {
+		r.UpdateInterval = defaults.UpdateInterval
+	}
+	if r.UpdateInterval <= 0 {
+		errs = append(errs, fieldError{"update_interval", "must be greater than 0"})
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		errs = append(errs, fieldError{"timezone", err.Error()})
+	}
+	r.location = loc
+	return errs
+}
+
+// buildZone builds the region's zone from whichever one of bounds, boundary_file, center or corridor is set
+func (r *Region) buildZone() []fieldError {
+	var kinds []string
+	if len(r.Bounds) > 0 {
+		kinds = append(kinds, "bounds")
+	}
+	if r.BoundaryFile != "" {
+		kinds = append(kinds, "boundary_file")
+	}
+	if len(r.Center) > 0 {
+		kinds = append(kinds, "center")
+	}
+	if len(r.Corridor) > 0 {
+		kinds = append(kinds, "corridor")
+	}
+	switch {
+	case len(kinds) == 0:
+		return []fieldError{{"bounds", "one of bounds, boundary_file, center or corridor is required"}}
+	case len(kinds) > 1:
+		return []fieldError{{kinds[1], fmt.Sprintf("can't be used together with %s", kinds[0])}}
+	}
+
+	switch kinds[0] {
+	case "boundary_file":
+		g, err := LoadBoundaryFile(r.BoundaryFile)
+		if err != nil {
+			return []fieldError{{"boundary_file", err.Error()}}
+		}
+		r.zone = g
+	case "center":
+		if len(r.Center) != 2 {
+			return []fieldError{{"center", "must be a [longitude, latitude] pair"}}
+		}
+		if r.RadiusMiles <= 0 {
+			return []fieldError{{"radius_miles", "must be greater than 0"}}
+		}
+		r.zone = RadiusZone{Lat: r.Center[1], Lon: r.Center[0], Miles: r.RadiusMiles}
+	case "corridor":
+		if err := checkPairs(r.Corridor); err != nil {
+			return []fieldError{{"corridor", err.Error()}}
+		}
+		if r.CorridorMiles <= 0 {
+			return []fieldError{{"corridor_miles", "must be greater than 0"}}
+		}
+		r.zone = CorridorZone{Path: r.Corridor, Miles: r.CorridorMiles}
+	default:
+		if len(r.Bounds) < 3 {
+			return []fieldError{{"bounds", "needs at least 3 points"}}
+		}
+		if err := checkPairs(r.Bounds); err != nil {
+			return []fieldError{{"bounds", err.Error()}}
+		}
+		r.zone = NewGeometry(Polygon{r.Bounds})
+	}
+	return nil
+}
+
+// checkPairs makes sure every point is a [lon, lat] pair
+func checkPairs(points [][]float64) error {
+	for _, pt := range points {
+		if len(pt) != 2 {
+			return errors.New("must be [longitude, latitude] pairs")
+		}
+	}
+	return nil
+}
+
+// LoadRegionsJSON parses a JSON list of regions, they are validated along with the rest of the configuration
+func LoadRegionsJSON(filename string) ([]*Region, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []*Region
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("no regions defined in %s", filename)
+	}
+	return loaded, nil
+}
+
+// MatchRegions returns every region containing the point
+func MatchRegions(lat, lon float64) []*Region {
+	var matched []*Region
+	for _, r := range currentConfig().Regions {
+		if r.Contains(lat, lon) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// MatchPredictedPath returns every region the predicted path (including the landing point) passes through
+func MatchPredictedPath(pred *SHPredictionResult) []*Region {
+	var matched []*Region
+	for _, r := range currentConfig().Regions {
+		if _, ok := pred.EntersRegion(r); ok || r.Contains(pred.Latitude, pred.Longitude) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// nearestRegionMiles returns how far the point is from the closest region, 0 if it is inside one
+func nearestRegionMiles(lat, lon float64) float64 {
+	closest := math.Inf(1)
+	for _, r := range currentConfig().Regions {
+		closest = math.Min(closest, r.DistanceMiles(lat, lon))
+	}
+	return closest
+}
+
+// MatchSondeRegions returns every region containing the sonde's live position or its predicted landing point,
+// so a sonde launched outside a region but forecast to land inside it is still alerted on
+func MatchSondeRegions(pkt SHPacket) []*Region {
+	pred := predictions.Get(pkt.Serial)
+	var matched []*Region
+	for _, r := range currentConfig().Regions {
+		if r.Contains(pkt.Lat, pkt.Lon) || (pred != nil && r.Contains(pred.Latitude, pred.Longitude)) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// regionByName finds a configured region, nil if it no longer exists
+func regionByName(name string) *Region {
+	for _, r := range currentConfig().Regions {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// regionLocation returns the timezone of a region by name, UTC if it no longer exists
+func regionLocation(name string) *time.Location {
+	if r := regionByName(name); r != nil {
+		return r.Location()
+	}
+	return time.UTC
+}
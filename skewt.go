@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	skewTWidth  = 1000
+	skewTHeight = 1000
+	// Plot area margins, the right one leaves room for the wind barbs
+	skewTMarginLeft   = 70
+	skewTMarginRight  = 110
+	skewTMarginTop    = 70
+	skewTMarginBottom = 60
+	// Pressure (hPa) at the bottom and top of the plot
+	skewTBottomPressure = 1050
+	skewTTopPressure    = 100
+	// Temperature (°C) range along the bottom of the plot
+	skewTMinTemp = -40
+	skewTMaxTemp = 50
+	// Layer depth (hPa) the winds are averaged over for each barb
+	windBarbLayer = 50
+	// Fewer temperature levels than this isn't much of a sounding
+	minSoundingLevels = 10
+)
+
+// Physical constants for the adiabats
+const (
+	gasConstantDry = 287.04  // J/(kg K)
+	specificHeat   = 1005.7  // J/(kg K), dry air at constant pressure
+	latentHeat     = 2.501e6 // J/kg, vaporization of water
+	molarRatio     = 0.622   // water vapor to dry air
+	kelvin         = 273.15
+	kappa          = gasConstantDry / specificHeat
+	metersPerKnot  = 0.514444
+)
+
+var (
+	soundingTempColor     = color.RGBA{R: 0xD0, G: 0x10, B: 0x10, A: 255}
+	soundingDewpointColor = color.RGBA{R: 0x10, G: 0x90, B: 0x20, A: 255}
+	isothermColor         = color.RGBA{R: 0x90, G: 0x90, B: 0x90, A: 255}
+	dryAdiabatColor       = color.RGBA{R: 0xE0, G: 0xA0, B: 0x60, A: 255}
+	moistAdiabatColor     = color.RGBA{R: 0x60, G: 0xA0, B: 0xD0, A: 255}
+)
+
+// SoundingLevel is one measurement of the atmosphere on the way up
+type SoundingLevel struct {
+	Pressure  float64 // hPa
+	Alt       float64 // m
+	Temp      float64 // °C
+	Dewpoint  float64 // °C, NaN without a humidity reading
+	WindSpeed float64 // m/s
+	WindDir   float64 // Degrees the wind blows from
+}
+
+// dewpoint computes the dewpoint (°C) from the temperature (°C) and relative humidity (%) with the Magnus formula
+func dewpoint(temp, humidity float64) float64 {
+	const b, c = 17.625, 243.04
+	gamma := math.Log(humidity/100) + b*temp/(c+temp)
+	return c * gamma / (b - gamma)
+}
+
+// saturationVaporPressure returns the saturation vapor pressure (hPa) over water at a temperature (°C)
+func saturationVaporPressure(temp float64) float64 {
+	return 6.112 * math.Exp(17.67*temp/(temp+243.5))
+}
+
+// SoundingFromHistory turns the ascent part of a sonde's history into sounding levels. The pressure comes
+// from the standard atmosphere when the sonde doesn't measure it. measured is false if any level's pressure was derived.
+func SoundingFromHistory(session *SondeSession, history []HistoryEntry) (levels []SoundingLevel, measured bool) {
+	measured = true
+	for _, h := range history {
+		if session.MaxAltTime != 0 && h.Time > session.MaxAltTime {
+			break
+		}
+		pkt := h.Packet
+		if !hasTemperature(pkt) {
+			continue
+		}
+		level := SoundingLevel{
+			Pressure:  pkt.Pressure,
+			Alt:       pkt.Alt,
+			Temp:      *pkt.Temp,
+			Dewpoint:  math.NaN(),
+			WindSpeed: pkt.VelH,
+			// The sonde drifts with the wind, so the wind comes from the opposite of its heading
+			WindDir: math.Mod(pkt.Heading+180, 360),
+		}
+		if level.Pressure <= 0 {
+			_, pa := standardAtmosphere(pkt.Alt)
+			level.Pressure = pa / 100
+			measured = false
+		}
+		if pkt.Humidity > 0 {
+			level.Dewpoint = dewpoint(*pkt.Temp, pkt.Humidity)
+		}
+		levels = append(levels, level)
+	}
+	return levels, measured
+}
+
+// skewT maps temperatures and pressures onto the plot. Pressure is logarithmic going up, and the
+// isotherms lean 45 degrees to the right.
+type skewT struct {
+	left, top, right, bottom float64
+}
+
+func (s skewT) y(pressure float64) float64 {
+	f := math.Log(skewTBottomPressure/pressure) / math.Log(skewTBottomPressure/skewTTopPressure)
+	return s.bottom - f*(s.bottom-s.top)
+}
+
+func (s skewT) x(temp, pressure float64) float64 {
+	return s.left + (temp-skewTMinTemp)/(skewTMaxTemp-skewTMinTemp)*(s.right-s.left) + (s.bottom - s.y(pressure))
+}
+
+// curve draws a line through temp(p) from the bottom of the plot to the top
+func (s skewT) curve(gc *gg.Context, temp func(p float64) float64) {
+	for p := float64(skewTBottomPressure); p >= skewTTopPressure; p -= 10 {
+		gc.LineTo(s.x(temp(p), p), s.y(p))
+	}
+	gc.Stroke()
+}
+
+// RenderSkewT renders a Skew-T log-P diagram of a sonde's ascent: temperature and dewpoint against
+// pressure over the isotherms and dry and moist adiabats, with wind barbs down the right hand side
+func RenderSkewT(serial string, session *SondeSession, history []HistoryEntry) (*bytes.Buffer, error) {
+	levels, measured := SoundingFromHistory(session, history)
+	if len(levels) < minSoundingLevels {
+		return nil, errors.New("not enough temperature readings for a sounding")
+	}
+
+	s := skewT{
+		left:   skewTMarginLeft,
+		top:    skewTMarginTop,
+		right:  skewTWidth - skewTMarginRight,
+		bottom: skewTHeight - skewTMarginBottom,
+	}
+	gc := gg.NewContext(skewTWidth, skewTHeight)
+	gc.SetRGB(1, 1, 1)
+	gc.Clear()
+
+	// Background lines, clipped to the plot
+	gc.DrawRectangle(s.left, s.top, s.right-s.left, s.bottom-s.top)
+	gc.Clip()
+	gc.SetLineWidth(1)
+	gc.SetColor(isothermColor)
+	for t := -120.0; t <= skewTMaxTemp; t += 10 {
+		gc.DrawLine(s.x(t, skewTBottomPressure), s.bottom, s.x(t, skewTTopPressure), s.top)
+		gc.Stroke()
+	}
+	gc.SetColor(dryAdiabatColor)
+	for theta := 250.0; theta <= 470; theta += 10 {
+		s.curve(gc, func(p float64) float64 { return theta*math.Pow(p/1000, kappa) - kelvin })
+	}
+	gc.SetColor(moistAdiabatColor)
+	gc.SetDash(6, 4)
+	for t := -16.0; t <= 36; t += 4 {
+		s.curve(gc, moistAdiabat(t))
+	}
+	gc.SetDash()
+	gc.ResetClip()
+
+	// Isobars with their labels, and the temperature labels along the bottom
+	gc.SetColor(isothermColor)
+	for p := 1000.0; p >= skewTTopPressure; p -= 100 {
+		gc.DrawLine(s.left, s.y(p), s.right, s.y(p))
+		gc.Stroke()
+		gc.SetRGB(0, 0, 0)
+		gc.DrawStringAnchored(fmt.Sprintf("%.0f", p), s.left-6, s.y(p), 1, 0.35)
+		gc.SetColor(isothermColor)
+	}
+	gc.SetRGB(0, 0, 0)
+	for t := float64(skewTMinTemp); t <= skewTMaxTemp; t += 10 {
+		gc.DrawStringAnchored(fmt.Sprintf("%.0f", t), s.x(t, skewTBottomPressure), s.bottom+12, 0.5, 0.35)
+	}
+	gc.DrawStringAnchored("Temperature (C)", (s.left+s.right)/2, s.bottom+34, 0.5, 0.35)
+	gc.Push()
+	gc.RotateAbout(-math.Pi/2, 16, (s.top+s.bottom)/2)
+	gc.DrawStringAnchored("Pressure (hPa)", 16, (s.top+s.bottom)/2, 0.5, 0.35)
+	gc.Pop()
+
+	// The sounding itself
+	gc.DrawRectangle(s.left, s.top, s.right-s.left, s.bottom-s.top)
+	gc.Clip()
+	gc.SetLineWidth(2.5)
+	gc.SetColor(soundingTempColor)
+	for _, l := range levels {
+		gc.LineTo(s.x(l.Temp, l.Pressure), s.y(l.Pressure))
+	}
+	gc.Stroke()
+	gc.SetColor(soundingDewpointColor)
+	for _, l := range levels {
+		if math.IsNaN(l.Dewpoint) {
+			// Gaps in the humidity readings leave gaps in the line
+			gc.Stroke()
+			continue
+		}
+		gc.LineTo(s.x(l.Dewpoint, l.Pressure), s.y(l.Pressure))
+	}
+	gc.Stroke()
+	gc.ResetClip()
+
+	gc.SetRGB(0, 0, 0)
+	gc.SetLineWidth(1)
+	gc.DrawRectangle(s.left, s.top, s.right-s.left, s.bottom-s.top)
+	gc.Stroke()
+
+	gc.SetLineWidth(1.5)
+	for _, w := range windLayers(levels) {
+		drawWindBarb(gc, s.right+skewTMarginRight/2, s.y(w.Pressure), w.WindSpeed/metersPerKnot, w.WindDir)
+	}
+	gc.DrawStringAnchored("Wind (kt)", s.right+skewTMarginRight/2, s.bottom+34, 0.5, 0.35)
+
+	launched := time.Unix(history[0].Time, 0).UTC()
+	gc.DrawStringAnchored(fmt.Sprintf("%s %s sounding, launched %s UTC", session.SondeType, serial, launched.Format("2006-01-02 15:04")), s.left, 20, 0, 0.35)
+	if !measured {
+		gc.DrawStringAnchored("Pressure derived from altitude (standard atmosphere)", s.left, 38, 0, 0.35)
+	}
+	legendX := s.right
+	for _, e := range []legendEntry{{Label: "Dewpoint", Color: soundingDewpointColor}, {Label: "Temperature", Color: soundingTempColor}} {
+		w, _ := gc.MeasureString(e.Label)
+		gc.SetRGB(0, 0, 0)
+		gc.DrawStringAnchored(e.Label, legendX, 20, 1, 0.35)
+		legendX -= w + 8
+		gc.SetColor(e.Color)
+		gc.SetLineWidth(3)
+		gc.DrawLine(legendX-22, 20, legendX, 20)
+		gc.Stroke()
+		legendX -= 22 + 16
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, gc.Image()); err != nil {
+		return nil, fmt.Errorf("png encode error: %w", err)
+	}
+	return buf, nil
+}
+
+// moistAdiabat returns the temperature along the saturated adiabat through t0 (°C) at 1000 hPa. It is
+// integrated once up front and interpolated from then on.
+func moistAdiabat(t0 float64) func(p float64) float64 {
+	const step = 5.0
+	temps := make(map[int]float64)
+	lapse := func(t, p float64) float64 {
+		tk := t + kelvin
+		rs := molarRatio * saturationVaporPressure(t) / (p - saturationVaporPressure(t))
+		return (gasConstantDry*tk + latentHeat*rs) / (specificHeat + latentHeat*latentHeat*rs*molarRatio/(gasConstantDry*tk*tk)) / p
+	}
+	for _, dir := range []float64{-step, step} {
+		t := t0
+		for p := 1000.0; p >= skewTTopPressure-step && p <= skewTBottomPressure+step; p += dir {
+			temps[int(p)] = t
+			t += lapse(t, p) * dir
+		}
+	}
+	return func(p float64) float64 {
+		lo := math.Floor(p/step) * step
+		f := (p - lo) / step
+		return temps[int(lo)]*(1-f) + temps[int(lo+step)]*f
+	}
+}
+
+// windLayers averages the winds of the sounding over layers of windBarbLayer hPa, one barb each
+func windLayers(levels []SoundingLevel) []SoundingLevel {
+	type layer struct {
+		east, north float64
+		n           int
+	}
+	layers := make(map[int]*layer)
+	for _, l := range levels {
+		key := int(math.Round(l.Pressure / windBarbLayer))
+		if l.Pressure < skewTTopPressure || l.Pressure > skewTBottomPressure {
+			continue
+		}
+		if layers[key] == nil {
+			layers[key] = &layer{}
+		}
+		// Averaged as vectors pointing where the wind comes from
+		dir := l.WindDir * math.Pi / 180
+		layers[key].east += l.WindSpeed * math.Sin(dir)
+		layers[key].north += l.WindSpeed * math.Cos(dir)
+		layers[key].n++
+	}
+
+	var winds []SoundingLevel
+	for key, l := range layers {
+		east, north := l.east/float64(l.n), l.north/float64(l.n)
+		winds = append(winds, SoundingLevel{
+			Pressure:  float64(key * windBarbLayer),
+			WindSpeed: math.Hypot(east, north),
+			WindDir:   math.Mod(math.Atan2(east, north)*180/math.Pi+360, 360),
+		})
+	}
+	return winds
+}
+
+// drawWindBarb draws a wind barb at x, y: the staff points where the wind comes from, with a pennant
+// for every 50 knots, a full barb for every 10 and a half barb for 5
+func drawWindBarb(gc *gg.Context, x, y, knots, from float64) {
+	const staff, barb, spacing = 40.0, 16.0, 6.0
+	knots = math.Round(knots/5) * 5
+	if knots < 5 {
+		gc.DrawCircle(x, y, 4)
+		gc.Stroke()
+		return
+	}
+
+	dir := from * math.Pi / 180
+	// Along the staff towards its tip, and across it to the side the barbs go (clockwise from the staff)
+	dx, dy := math.Sin(dir), -math.Cos(dir)
+	px, py := -dy, dx
+	tipX, tipY := x+dx*staff, y+dy*staff
+	gc.DrawLine(x, y, tipX, tipY)
+	gc.Stroke()
+
+	pos := 0.0
+	for ; knots >= 50; knots -= 50 {
+		ax, ay := tipX-dx*pos, tipY-dy*pos
+		gc.MoveTo(ax, ay)
+		gc.LineTo(ax+px*barb, ay+py*barb)
+		gc.LineTo(ax-dx*spacing, ay-dy*spacing)
+		gc.ClosePath()
+		gc.Fill()
+		pos += spacing + 2
+	}
+	for ; knots >= 10; knots -= 10 {
+		ax, ay := tipX-dx*pos, tipY-dy*pos
+		gc.DrawLine(ax, ay, ax+px*barb+dx*4, ay+py*barb+dy*4)
+		gc.Stroke()
+		pos += spacing
+	}
+	if knots >= 5 {
+		if pos == 0 {
+			// A lone half barb sits a little way in from the tip, so it isn't mistaken for a full one
+			pos = spacing
+		}
+		ax, ay := tipX-dx*pos, tipY-dy*pos
+		gc.DrawLine(ax, ay, ax+(px*barb+dx*4)/2, ay+(py*barb+dy*4)/2)
+		gc.Stroke()
+	}
+}
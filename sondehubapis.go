@@ -19,11 +19,54 @@ type SHPredictionResult struct {
 	Descending    int       `json:"descending"`
 	Landed        int       `json:"landed"`
 	Data          string    `json:"data"`
+
+	// Decoded from Data
+	Path []PredictionPoint `json:"-"`
+	// Set when the prediction comes from our own predictor rather than SondeHub, see predictor.go
+	Local bool `json:"-"`
+}
+
+// PredictionPoint is one point of a predicted flight path
+type PredictionPoint struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	Alt  float64 `json:"alt"`
+	Time float64 `json:"time"`
 }
 
 // GetPrediction fetches the first SHPredictionResult for a given serial from SondeHub API.
 func GetPrediction(serial string) (*SHPredictionResult, error) {
-	url := fmt.Sprintf("https://api.v2.sondehub.org/predictions?vehicles=%s", serial)
+	results, err := fetchPredictions(fmt.Sprintf("https://api.v2.sondehub.org/predictions?vehicles=%s", serial))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no prediction results found for serial: %s", serial)
+	}
+	pred := &results[0]
+	if err := pred.decodeLanding(); err != nil {
+		return nil, err
+	}
+	return pred, nil
+}
+
+// GetAllPredictions fetches the current prediction for every sonde SondeHub is tracking, keyed by serial.
+// Predictions without a usable path are skipped.
+func GetAllPredictions() (map[string]*SHPredictionResult, error) {
+	results, err := fetchPredictions("https://api.v2.sondehub.org/predictions?vehicles=")
+	if err != nil {
+		return nil, err
+	}
+	preds := make(map[string]*SHPredictionResult, len(results))
+	for i := range results {
+		if results[i].decodeLanding() == nil {
+			preds[results[i].Vehicle] = &results[i]
+		}
+	}
+	return preds, nil
+}
+
+func fetchPredictions(url string) ([]SHPredictionResult, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch prediction: %w", err)
@@ -36,27 +79,35 @@ func GetPrediction(serial string) (*SHPredictionResult, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
 		return nil, fmt.Errorf("failed to decode prediction response: %w", err)
 	}
-	if len(results) == 0 {
-		return nil, fmt.Errorf("no prediction results found for serial: %s", serial)
-	}
-	pred := &results[0]
+	return results, nil
+}
+
+// decodeLanding decodes the predicted path and sets the landing position and time from its last point
+func (pred *SHPredictionResult) decodeLanding() error {
 	// Decode the JSON-in-JSON data field
-	var predData []struct {
-		Lat  float64 `json:"lat"`
-		Lon  float64 `json:"lon"`
-		Time float64 `json:"time"`
-	}
+	var predData []PredictionPoint
 	if err := json.Unmarshal([]byte(pred.Data), &predData); err != nil {
-		return nil, fmt.Errorf("failed to decode prediction data field: %w", err)
+		return fmt.Errorf("failed to decode prediction data field: %w", err)
 	}
 	if len(predData) == 0 {
-		return nil, fmt.Errorf("no prediction data points found in data field")
+		return fmt.Errorf("no prediction data points found in data field")
 	}
+	pred.Path = predData
 	last := predData[len(predData)-1]
 	pred.Latitude = last.Lat
 	pred.Longitude = last.Lon
 	pred.Time = time.Unix(int64(last.Time), 0).UTC()
-	return pred, nil
+	return nil
+}
+
+// EntersRegion returns the first time the predicted path is inside the region
+func (pred *SHPredictionResult) EntersRegion(r *Region) (time.Time, bool) {
+	for _, pt := range pred.Path {
+		if r.Contains(pt.Lat, pt.Lon) {
+			return time.Unix(int64(pt.Time), 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
 }
 
 // GetReceivers fetches receiver locations from SondeHub and returns a []Point (lat/lon/name)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -22,8 +23,9 @@ type SHPacket struct {
 	Lat              float64   `json:"lat"`
 	Lon              float64   `json:"lon"`
 	Alt              float64   `json:"alt"`
-	Temp             float64   `json:"temp"`
+	Temp             *float64  `json:"temp,omitempty"` // °C, nil without a temperature sensor, see hasTemperature
 	Humidity         float64   `json:"humidity"`
+	Pressure         float64   `json:"pressure"` // hPa, only some sondes have a pressure sensor
 	VelV             float64   `json:"vel_v"`
 	VelH             float64   `json:"vel_h"`
 	Heading          float64   `json:"heading"`
@@ -43,6 +45,12 @@ type SHPacket struct {
 	UploaderAlt      float64   `json:"uploader_alt"`
 }
 
+// hasTemperature returns true if the packet has a temperature reading. Sondes without a temperature
+// sensor leave it out, or send absolute zero.
+func hasTemperature(pkt SHPacket) bool {
+	return pkt.Temp != nil && *pkt.Temp > -273
+}
+
 // FilterUnique returns a map of serial -> SHPacket, keeping only the packet with the highest Frame for each serial.
 func FilterUnique(packets []SHPacket) map[string]SHPacket {
 	result := make(map[string]SHPacket)
@@ -56,9 +64,17 @@ func FilterUnique(packets []SHPacket) map[string]SHPacket {
 }
 
 // ParseBatch takes in a JSON array of SHPackets and returns the filtered unique packets.
+// Single packet payloads (as published on the per-serial sondes/<serial> topics) are also accepted.
 func ParseBatch(data []byte) ([]SHPacket, error) {
 	var packets []SHPacket
-	if err := json.Unmarshal(data, &packets); err != nil {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var pkt SHPacket
+		if err := json.Unmarshal(trimmed, &pkt); err != nil {
+			return nil, err
+		}
+		packets = append(packets, pkt)
+	} else if err := json.Unmarshal(data, &packets); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PacketHandler receives normalized SondeHub packets from a TelemetrySource.
+type PacketHandler func(pkts []SHPacket)
+
+// TelemetrySource is anything that can feed radiosonde telemetry into the processing pipeline.
+// Every source is responsible for normalizing its own wire format into SHPackets.
+type TelemetrySource interface {
+	// Name is a short identifier used in logs and in the TELEMETRY_SOURCES variable
+	Name() string
+	// Start connects the source and begins calling handler for every batch of packets
+	Start(handler PacketHandler) error
+	// Stop disconnects the source
+	Stop()
+}
+
+// knownTelemetrySources are the names accepted in telemetry_sources
+var knownTelemetrySources = map[string]string{
+	"sondehub": "sondehub",
+	"mqtt":     "sondehub",
+	"autorx":   "autorx",
+	"auto_rx":  "autorx",
+}
+
+func isKnownTelemetrySource(name string) bool {
+	_, ok := knownTelemetrySources[strings.ToLower(strings.TrimSpace(name))]
+	return ok
+}
+
+// NewTelemetrySources builds the telemetry sources listed in the configuration.
+func NewTelemetrySources(cfg *Config) ([]TelemetrySource, error) {
+	var sources []TelemetrySource
+	for _, name := range cfg.TelemetrySources {
+		switch knownTelemetrySources[strings.ToLower(strings.TrimSpace(name))] {
+		case "sondehub":
+			sources = append(sources, NewSondeHubSource(cfg.MQTT))
+		case "autorx":
+			sources = append(sources, NewAutoRXSource(cfg.AutoRX.Addr, cfg.AutoRX.Port))
+		default:
+			return nil, fmt.Errorf("unknown telemetry source %q", name)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no telemetry sources configured")
+	}
+	return sources, nil
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	staticmaps "github.com/flopp/go-staticmaps"
+	_ "modernc.org/sqlite"
+)
+
+// TileProviderConfig is a tile server, or a local tile file, that map profiles can use by name. A
+// configured provider with the same name as a built in one replaces it.
+type TileProviderConfig struct {
+	// XYZ URL template with {z}, {x} and {y}, and optionally {s} for one of the shards and {api_key}
+	URL    string   `yaml:"url"`
+	Shards []string `yaml:"shards"`
+	APIKey string   `yaml:"api_key"`
+	// Environment variable to read the API key from instead, to keep it out of the file
+	APIKeyEnv string `yaml:"api_key_env"`
+	// Local MBTiles or PMTiles file with raster tiles, used instead of a URL to render without network access
+	File        string `yaml:"file"`
+	TileSize    int    `yaml:"tile_size"`
+	Attribution string `yaml:"attribution"`
+	// User-Agent for tile requests, map.user_agent when left out
+	UserAgent string `yaml:"user_agent"`
+
+	provider *staticmaps.TileProvider
+}
+
+// validate checks the provider and builds the staticmaps provider for it
+func (t *TileProviderConfig) validate(name string) []fieldError {
+	var errs []fieldError
+	if t.TileSize == 0 {
+		t.TileSize = 256
+	}
+	if t.TileSize < 0 {
+		errs = append(errs, fieldError{"tile_size", "must be greater than 0"})
+	}
+	if t.APIKeyEnv != "" {
+		if t.APIKey = os.Getenv(t.APIKeyEnv); t.APIKey == "" {
+			errs = append(errs, fieldError{"api_key_env", fmt.Sprintf("$%s is not set", t.APIKeyEnv)})
+		}
+	}
+
+	p := &staticmaps.TileProvider{
+		Name:        name,
+		Attribution: t.Attribution,
+		TileSize:    t.TileSize,
+		Shards:      t.Shards,
+		APIKey:      t.APIKey,
+	}
+	switch {
+	case (t.URL == "") == (t.File == ""):
+		errs = append(errs, fieldError{"url", "exactly one of url or file is required"})
+	case t.URL != "":
+		for _, part := range []string{"{z}", "{x}", "{y}"} {
+			if !strings.Contains(t.URL, part) {
+				errs = append(errs, fieldError{"url", "must contain " + part})
+			}
+		}
+		if strings.Contains(t.URL, "{s}") && len(t.Shards) == 0 {
+			errs = append(errs, fieldError{"shards", "are required when the url contains {s}"})
+		}
+		// Tiles are cached by provider name. The URL's hash keeps them apart from a built in provider of the
+		// same name, and from the tiles of a server the provider pointed at before.
+		h := fnv.New32a()
+		h.Write([]byte(t.URL))
+		p.Name = fmt.Sprintf("%s-%08x", name, h.Sum32())
+		p.URLPattern = strings.NewReplacer(
+			"%", "%%",
+			"{s}", "%[1]s",
+			"{z}", "%[2]d",
+			"{x}", "%[3]d",
+			"{y}", "%[4]d",
+			"{api_key}", "%[5]s",
+		).Replace(t.URL)
+	default:
+		tf, err := openTileFile(t.File)
+		if err != nil {
+			errs = append(errs, fieldError{"file", err.Error()})
+			break
+		}
+		p.Attribution = defaultString(p.Attribution, tf.attribution)
+		// Areas the file doesn't cover are left blank instead of failing the whole map
+		p.IgnoreNotFound = true
+		p.URLPattern = tileFileScheme + "://tiles/%[2]d/%[3]d/%[4]d?file=" + strings.ReplaceAll(url.QueryEscape(tf.path), "%", "%%")
+	}
+	t.provider = p
+	return errs
+}
+
+// apply sets the map up to draw with the provider's tiles
+func (t *TileProviderConfig) apply(m *staticmaps.Context) {
+	m.SetTileProvider(t.provider)
+	m.SetUserAgent(defaultString(t.UserAgent, currentConfig().Map.UserAgent))
+	if t.File != "" {
+		// The tiles are on disk already, copying them into the cache would only take up space
+		m.SetCache(nil)
+	} else {
+		m.SetCache(staticmaps.NewTileCache(currentConfig().Map.TileCacheDir, 0o755))
+	}
+}
+
+// tileProvider looks up a tile provider by name, in the configured ones and then the built in ones
+func tileProvider(name string) (*TileProviderConfig, error) {
+	return lookupTileProvider(name, currentConfig().Map.TileProviders)
+}
+
+func lookupTileProvider(name string, configured map[string]*TileProviderConfig) (*TileProviderConfig, error) {
+	if t, ok := configured[name]; ok && t.provider != nil {
+		return t, nil
+	}
+	builtin := staticmaps.GetTileProviders("")
+	if p, ok := builtin[name]; ok {
+		return &TileProviderConfig{provider: p}, nil
+	}
+	names := slices.Collect(maps.Keys(builtin))
+	for name := range configured {
+		if _, ok := builtin[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return nil, fmt.Errorf("unknown tile provider %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Tiles from local files are fetched by staticmaps like any other tiles, through this URL scheme
+const tileFileScheme = "tilefile"
+
+// tileFile is an opened MBTiles or PMTiles file
+type tileFile struct {
+	path        string
+	attribution string
+	// tile returns the image data of a tile, nil when the file doesn't have it
+	tile func(z, x, y int) ([]byte, error)
+}
+
+var (
+	tileFiles           = make(map[string]*tileFile)
+	tileFilesMu         sync.Mutex
+	registerTileFile    sync.Once
+	registerTileFileErr error
+)
+
+// openTileFile opens a tile file, or returns it if it's open already. Files stay open, they are
+// only ever read from.
+func openTileFile(path string) (*tileFile, error) {
+	if err := registerTileFileScheme(); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	tileFilesMu.Lock()
+	defer tileFilesMu.Unlock()
+	if tf, ok := tileFiles[path]; ok {
+		return tf, nil
+	}
+
+	var tf *tileFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mbtiles":
+		tf, err = openMBTiles(path)
+	case ".pmtiles":
+		tf, err = openPMTiles(path)
+	default:
+		return nil, errors.New("unknown tile file type, expected .mbtiles or .pmtiles")
+	}
+	if err != nil {
+		return nil, err
+	}
+	tileFiles[path] = tf
+	return tf, nil
+}
+
+// registerTileFileScheme makes the default HTTP transport answer tilefile:// requests. staticmaps
+// downloads every tile with http.DefaultClient and has no way to pass it another client or
+// transport, so the scheme has to be registered globally. Other schemes are left alone, so every
+// other request still goes out as usual.
+func registerTileFileScheme() error {
+	registerTileFile.Do(func() {
+		t, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			registerTileFileErr = fmt.Errorf("can't serve tile files, http.DefaultTransport is a %T", http.DefaultTransport)
+			return
+		}
+		t.RegisterProtocol(tileFileScheme, tileFileTransport{})
+	})
+	return registerTileFileErr
+}
+
+// tileFileTransport answers tile requests from the opened tile files. Only files opened for a configured
+// provider are served, anything else is not found, so a tilefile:// URL can't read any other file.
+type tileFileTransport struct{}
+
+func (tileFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tileFilesMu.Lock()
+	tf, ok := tileFiles[req.URL.Query().Get("file")]
+	tileFilesMu.Unlock()
+	if !ok {
+		return tileFileResponse(req, nil), nil
+	}
+
+	var zxy [3]int
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		return tileFileResponse(req, nil), nil
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return tileFileResponse(req, nil), nil
+		}
+		zxy[i] = n
+	}
+	data, err := tf.tile(zxy[0], zxy[1], zxy[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tf.path, err)
+	}
+	return tileFileResponse(req, data), nil
+}
+
+// tileFileResponse wraps a tile in a response, or answers 404 Not Found when data is nil
+func tileFileResponse(req *http.Request, data []byte) *http.Response {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}
+	if data == nil {
+		resp.Status, resp.StatusCode = "404 Not Found", http.StatusNotFound
+	}
+	resp.ContentLength = int64(len(data))
+	return resp
+}
+
+// openMBTiles opens an MBTiles file, an SQLite database with the tiles in TMS order
+func openMBTiles(path string) (*tileFile, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	rows, err := db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reading MBTiles metadata: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("reading MBTiles metadata: %w", err)
+		}
+		metadata[name] = value
+	}
+	if format := metadata["format"]; format != "png" && format != "jpg" && format != "jpeg" {
+		db.Close()
+		return nil, fmt.Errorf("MBTiles format is %q, only png and jpg raster tiles can be drawn", format)
+	}
+
+	stmt, err := db.Prepare("SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reading MBTiles tiles: %w", err)
+	}
+	return &tileFile{
+		path:        path,
+		attribution: metadata["attribution"],
+		tile: func(z, x, y int) ([]byte, error) {
+			var data []byte
+			err := stmt.QueryRow(z, x, 1<<z-1-y).Scan(&data)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return data, err
+		},
+	}, nil
+}
+
+// PMTiles v3 header fields we need, see https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md
+type pmtilesHeader struct {
+	RootOffset, RootLength         uint64
+	MetadataOffset, MetadataLength uint64
+	LeafOffset, LeafLength         uint64
+	DataOffset, DataLength         uint64
+	InternalCompression            uint8
+	TileCompression                uint8
+	TileType                       uint8
+}
+
+const (
+	pmtilesHeaderSize = 127
+	// The spec limits directories to three levels below the root
+	pmtilesMaxDepth = 4
+
+	pmtilesCompressionNone = 1
+	pmtilesCompressionGzip = 2
+	pmtilesTilePNG         = 2
+	pmtilesTileJPEG        = 3
+)
+
+// pmtilesEntry is one directory entry, a run of tiles or (with a run length of 0) a leaf directory
+type pmtilesEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint64
+	RunLength uint64
+}
+
+// openPMTiles opens a PMTiles v3 archive, a single file with the tiles in Hilbert curve order
+func openPMTiles(path string) (*tileFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, pmtilesHeaderSize)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading PMTiles header: %w", err)
+	}
+	if string(buf[:7]) != "PMTiles" || buf[7] != 3 {
+		f.Close()
+		return nil, errors.New("not a PMTiles version 3 file")
+	}
+	u64 := func(at int) uint64 { return binary.LittleEndian.Uint64(buf[at:]) }
+	h := pmtilesHeader{
+		RootOffset: u64(8), RootLength: u64(16),
+		MetadataOffset: u64(24), MetadataLength: u64(32),
+		LeafOffset: u64(40), LeafLength: u64(48),
+		DataOffset: u64(56), DataLength: u64(64),
+		InternalCompression: buf[97],
+		TileCompression:     buf[98],
+		TileType:            buf[99],
+	}
+	if h.TileType != pmtilesTilePNG && h.TileType != pmtilesTileJPEG {
+		f.Close()
+		return nil, errors.New("only PMTiles with png or jpg raster tiles can be drawn")
+	}
+	for _, c := range []uint8{h.InternalCompression, h.TileCompression} {
+		if c != pmtilesCompressionNone && c != pmtilesCompressionGzip {
+			f.Close()
+			return nil, errors.New("only uncompressed or gzip compressed PMTiles are supported")
+		}
+	}
+
+	root, err := readPMTilesDirectory(f, h, h.RootOffset, h.RootLength)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tf := &tileFile{path: path}
+	if data, err := readPMTilesSection(f, h.InternalCompression, h.MetadataOffset, h.MetadataLength); err == nil {
+		var metadata struct {
+			Attribution string `json:"attribution"`
+		}
+		if json.Unmarshal(data, &metadata) == nil {
+			tf.attribution = metadata.Attribution
+		}
+	}
+	tf.tile = func(z, x, y int) ([]byte, error) {
+		if z < 0 || z > 31 || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+			return nil, nil
+		}
+		id := pmtilesTileID(z, uint64(x), uint64(y))
+		dir := root
+		for depth := 0; depth < pmtilesMaxDepth; depth++ {
+			e, ok := findPMTilesEntry(dir, id)
+			if !ok {
+				return nil, nil
+			}
+			if e.RunLength > 0 {
+				return readPMTilesSection(f, h.TileCompression, h.DataOffset+e.Offset, e.Length)
+			}
+			if dir, err = readPMTilesDirectory(f, h, h.LeafOffset+e.Offset, e.Length); err != nil {
+				return nil, err
+			}
+		}
+		return nil, errors.New("PMTiles directories nested too deep")
+	}
+	return tf, nil
+}
+
+// readPMTilesSection reads and decompresses part of the file
+func readPMTilesSection(f *os.File, compression uint8, offset, length uint64) ([]byte, error) {
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	if compression != pmtilesCompressionGzip {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// readPMTilesDirectory reads a directory: the number of entries, then each column of the entries
+// in turn as varints. Tile IDs are deltas from the previous entry, offsets are 0 for tiles directly
+// after the previous one and the offset plus one otherwise.
+func readPMTilesDirectory(f *os.File, h pmtilesHeader, offset, length uint64) ([]pmtilesEntry, error) {
+	data, err := readPMTilesSection(f, h.InternalCompression, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("reading PMTiles directory: %w", err)
+	}
+	r := bytes.NewReader(data)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading PMTiles directory: %w", err)
+	}
+	if n > uint64(len(data)) {
+		return nil, errors.New("reading PMTiles directory: bad entry count")
+	}
+	entries := make([]pmtilesEntry, n)
+	columns := []func(i int, v uint64){
+		func(i int, v uint64) {
+			entries[i].TileID = v
+			if i > 0 {
+				entries[i].TileID += entries[i-1].TileID
+			}
+		},
+		func(i int, v uint64) { entries[i].RunLength = v },
+		func(i int, v uint64) { entries[i].Length = v },
+		func(i int, v uint64) {
+			if v == 0 && i > 0 {
+				entries[i].Offset = entries[i-1].Offset + entries[i-1].Length
+			} else {
+				entries[i].Offset = v - 1
+			}
+		},
+	}
+	for _, set := range columns {
+		for i := range entries {
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("reading PMTiles directory: %w", err)
+			}
+			set(i, v)
+		}
+	}
+	return entries, nil
+}
+
+// findPMTilesEntry finds the entry with the tile, or the leaf directory that may have it
+func findPMTilesEntry(entries []pmtilesEntry, id uint64) (pmtilesEntry, bool) {
+	// The last entry starting at or before the tile
+	i, found := slices.BinarySearchFunc(entries, id, func(e pmtilesEntry, id uint64) int {
+		switch {
+		case e.TileID < id:
+			return -1
+		case e.TileID > id:
+			return 1
+		}
+		return 0
+	})
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return pmtilesEntry{}, false
+	}
+	e := entries[i]
+	if e.RunLength == 0 || id-e.TileID < e.RunLength {
+		return e, true
+	}
+	return pmtilesEntry{}, false
+}
+
+// pmtilesTileID numbers tiles zoom level by zoom level, along a Hilbert curve within each level
+func pmtilesTileID(z int, x, y uint64) uint64 {
+	// Tiles in all the lower zoom levels
+	id := (uint64(1)<<(2*z) - 1) / 3
+	n := uint64(1) << z
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		id += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = n-1-x, n-1-y
+			}
+			x, y = y, x
+		}
+	}
+	return id
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPMTilesTileID(t *testing.T) {
+	// From the PMTiles spec and its reference implementation
+	tests := []struct {
+		z    int
+		x, y uint64
+		want uint64
+	}{
+		{0, 0, 0, 0},
+		{1, 0, 0, 1},
+		{1, 0, 1, 2},
+		{1, 1, 1, 3},
+		{1, 1, 0, 4},
+		{2, 0, 0, 5},
+		{3, 0, 0, 21},
+		{12, 3423, 1763, 19078479},
+		{20, 0, 0, 366503875925},
+		{31, 0, 0, 1537228672809129301},
+	}
+	for _, tt := range tests {
+		if got := pmtilesTileID(tt.z, tt.x, tt.y); got != tt.want {
+			t.Errorf("pmtilesTileID(%d, %d, %d) = %d, want %d", tt.z, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestFindPMTilesEntry(t *testing.T) {
+	entries := []pmtilesEntry{
+		{TileID: 5, Offset: 0, Length: 10, RunLength: 1},
+		{TileID: 6, Offset: 10, Length: 10, RunLength: 3},
+		{TileID: 20, Offset: 0, Length: 50, RunLength: 0},
+	}
+	tests := []struct {
+		id     uint64
+		want   uint64
+		wantOK bool
+	}{
+		{id: 4, wantOK: false},
+		{id: 5, want: 5, wantOK: true},
+		{id: 6, want: 6, wantOK: true},
+		{id: 8, want: 6, wantOK: true},
+		{id: 9, wantOK: false}, // past the end of the run
+		{id: 20, want: 20, wantOK: true},
+		{id: 1000, want: 20, wantOK: true}, // the leaf directory may have it
+	}
+	for _, tt := range tests {
+		e, ok := findPMTilesEntry(entries, tt.id)
+		if ok != tt.wantOK || (ok && e.TileID != tt.want) {
+			t.Errorf("findPMTilesEntry(%d) = %d, %v, want %d, %v", tt.id, e.TileID, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestReadPMTilesDirectory(t *testing.T) {
+	entries := []pmtilesEntry{
+		{TileID: 0, Offset: 0, Length: 100, RunLength: 1},
+		{TileID: 1, Offset: 100, Length: 20, RunLength: 4}, // directly after the previous tile
+		{TileID: 5, Offset: 0, Length: 20, RunLength: 1},   // the same data as the first tile
+		{TileID: 300, Offset: 500, Length: 64, RunLength: 0},
+	}
+	for _, compression := range []uint8{pmtilesCompressionNone, pmtilesCompressionGzip} {
+		data := encodePMTilesSection(t, compression, encodePMTilesDirectory(entries))
+		f := writeTempFile(t, "dir", data)
+		got, err := readPMTilesDirectory(f, pmtilesHeader{InternalCompression: compression}, 0, uint64(len(data)))
+		if err != nil {
+			t.Fatalf("compression %d: %v", compression, err)
+		}
+		if !slices.Equal(got, entries) {
+			t.Errorf("compression %d: got %+v, want %+v", compression, got, entries)
+		}
+	}
+}
+
+func TestOpenPMTiles(t *testing.T) {
+	tileData := []byte("z0z1z2")
+	root := []pmtilesEntry{
+		{TileID: 0, Offset: 0, Length: 2, RunLength: 1},
+		{TileID: 1, Offset: 0, Length: 0, RunLength: 0}, // set once the leaf is encoded
+	}
+	// Every zoom 1 tile is the same, and only the first zoom 2 tile is there
+	leaf := encodePMTilesSection(t, pmtilesCompressionGzip, encodePMTilesDirectory([]pmtilesEntry{
+		{TileID: 1, Offset: 2, Length: 2, RunLength: 4},
+		{TileID: 5, Offset: 4, Length: 2, RunLength: 1},
+	}))
+	root[1].Length = uint64(len(leaf))
+	rootData := encodePMTilesSection(t, pmtilesCompressionGzip, encodePMTilesDirectory(root))
+	metadata := encodePMTilesSection(t, pmtilesCompressionGzip, []byte(`{"attribution":"Test tiles"}`))
+
+	header := make([]byte, pmtilesHeaderSize)
+	copy(header, "PMTiles")
+	header[7] = 3
+	offset := uint64(pmtilesHeaderSize)
+	for i, section := range [][]byte{rootData, metadata, leaf, tileData} {
+		binary.LittleEndian.PutUint64(header[8+16*i:], offset)
+		binary.LittleEndian.PutUint64(header[16+16*i:], uint64(len(section)))
+		offset += uint64(len(section))
+	}
+	header[97] = pmtilesCompressionGzip
+	header[98] = pmtilesCompressionNone
+	header[99] = pmtilesTilePNG
+
+	path := filepath.Join(t.TempDir(), "test.pmtiles")
+	if err := os.WriteFile(path, slices.Concat(header, rootData, metadata, leaf, tileData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := openPMTiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.attribution != "Test tiles" {
+		t.Errorf("attribution = %q, want %q", tf.attribution, "Test tiles")
+	}
+
+	tests := []struct {
+		z, x, y int
+		want    string
+	}{
+		{0, 0, 0, "z0"},
+		{1, 0, 0, "z1"},
+		{1, 1, 0, "z1"},
+		{2, 0, 0, "z2"},
+		{2, 1, 0, ""},
+		{3, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		data, err := tf.tile(tt.z, tt.x, tt.y)
+		if err != nil {
+			t.Fatalf("tile %d/%d/%d: %v", tt.z, tt.x, tt.y, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("tile %d/%d/%d = %q, want %q", tt.z, tt.x, tt.y, data, tt.want)
+		}
+	}
+}
+
+func TestMBTilesFlipsY(t *testing.T) {
+	tf, err := openMBTiles(writeTestMBTiles(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.attribution != "Test tiles" {
+		t.Errorf("attribution = %q, want %q", tf.attribution, "Test tiles")
+	}
+	if data, err := tf.tile(2, 3, 0); err != nil || !bytes.Equal(data, []byte{1, 2}) {
+		t.Errorf("tile 2/3/0 = %v, %v, want [1 2]", data, err)
+	}
+	if data, err := tf.tile(2, 3, 3); err != nil || data != nil {
+		t.Errorf("tile 2/3/3 = %v, %v, want nothing", data, err)
+	}
+}
+
+func TestTileFileTransport(t *testing.T) {
+	tf, err := openTileFile(writeTestMBTiles(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"tile", "tilefile://tiles/2/3/0?file=" + url.QueryEscape(tf.path), http.StatusOK, "\x01\x02"},
+		{"missing tile", "tilefile://tiles/2/3/3?file=" + url.QueryEscape(tf.path), http.StatusNotFound, ""},
+		{"bad tile path", "tilefile://tiles/2/x/0?file=" + url.QueryEscape(tf.path), http.StatusNotFound, ""},
+		// Only files opened for a provider are served, never whatever the URL points at
+		{"file that isn't open", "tilefile://tiles/0/0/0?file=" + url.QueryEscape("/etc/passwd"), http.StatusNotFound, ""},
+		{"no file", "tilefile://tiles/0/0/0", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.url, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTileProviderCacheName(t *testing.T) {
+	name := func(url string) string {
+		t.Helper()
+		p := &TileProviderConfig{URL: url}
+		if errs := p.validate("osm"); len(errs) > 0 {
+			t.Fatalf("validate(%q) = %v", url, errs)
+		}
+		return p.provider.Name
+	}
+	own := name("https://tiles.example.com/osm/{z}/{x}/{y}.png")
+	if own == "osm" {
+		t.Error("a configured osm provider shares the built in one's tile cache")
+	}
+	if own != name("https://tiles.example.com/osm/{z}/{x}/{y}.png") {
+		t.Error("the same URL got a different tile cache")
+	}
+	if own == name("https://tiles.example.org/osm/{z}/{x}/{y}.png") {
+		t.Error("a changed URL kept the old tile cache")
+	}
+}
+
+// writeTestMBTiles writes an MBTiles file with a single tile, 2/3/0 in XYZ order
+func writeTestMBTiles(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mbtiles")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE metadata (name TEXT, value TEXT)",
+		"CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)",
+		"INSERT INTO metadata VALUES ('format', 'png'), ('attribution', 'Test tiles')",
+		// TMS rows count up from the south, so this is the top right tile at zoom 2
+		"INSERT INTO tiles VALUES (2, 3, 3, x'0102')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// encodePMTilesDirectory writes entries the way readPMTilesDirectory reads them
+func encodePMTilesDirectory(entries []pmtilesEntry) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(entries)))
+	for i, e := range entries {
+		delta := e.TileID
+		if i > 0 {
+			delta -= entries[i-1].TileID
+		}
+		buf = binary.AppendUvarint(buf, delta)
+	}
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.RunLength)
+	}
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.Length)
+	}
+	for i, e := range entries {
+		if i > 0 && e.Offset == entries[i-1].Offset+entries[i-1].Length {
+			buf = binary.AppendUvarint(buf, 0)
+		} else {
+			buf = binary.AppendUvarint(buf, e.Offset+1)
+		}
+	}
+	return buf
+}
+
+func encodePMTilesSection(t *testing.T, compression uint8, data []byte) []byte {
+	t.Helper()
+	if compression != pmtilesCompressionGzip {
+		return data
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTempFile(t *testing.T, name string, data []byte) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
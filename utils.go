@@ -3,9 +3,9 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"math"
+	"sort"
 	"time"
 )
 
@@ -63,6 +63,26 @@ func FindClosestPoint(lat, lon float64, points []Point) (Point, float64, error)
 	return closest, minDist, nil
 }
 
+// nearestPoints returns up to n points within maxMiles, closest first
+func nearestPoints(lat, lon float64, points []Point, n int, maxMiles float64) []Point {
+	type candidate struct {
+		p    Point
+		dist float64
+	}
+	var candidates []candidate
+	for _, p := range points {
+		if d := haversineMiles(lat, lon, p.Lat, p.Lon); d <= maxMiles {
+			candidates = append(candidates, candidate{p, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	var nearest []Point
+	for i := 0; i < len(candidates) && i < n; i++ {
+		nearest = append(nearest, candidates[i].p)
+	}
+	return nearest
+}
+
 // ParseLaunchSitesJSON parses launchsites.json into a []Point
 func ParseLaunchSitesJSON(filename string) ([]Point, error) {
 	data, err := ioutil.ReadFile(filename)
@@ -96,24 +116,6 @@ func MetersToFeet(meters float64) float64 {
 	return meters * feetPerMeter
 }
 
-// Get Location from Radar response (City, ST or <County> County, ST)
-func GetLocationFromRadarResponse(resp RadarGeoResponse) string {
-	// Since the city can be empty, we can also use the county
-	// Keep in mind that this was designed for US locations, but it wouldn't be hard to extend it to other countries
-	var locationText string
-	// Just in case, if the response is empty, return a default message
-	if len(resp.Addresses) == 0 {
-		return "Location not found"
-	}
-	if resp.Addresses[0].City != "" {
-		locationText = fmt.Sprintf("%s, %s", resp.Addresses[0].City, resp.Addresses[0].StateCode)
-	} else if resp.Addresses[0].County != "" {
-		locationText = fmt.Sprintf("%s County, %s", resp.Addresses[0].County, resp.Addresses[0].StateCode)
-	}
-
-	return locationText
-}
-
 // IsUsualTime returns true if the UTC hour is 11-13 or 23-01
 func IsUsualTime(t time.Time) bool {
 	hour := t.UTC().Hour()
@@ -0,0 +1,83 @@
+package main
+
+import "math"
+
+// Miles per degree of latitude (and of longitude at the equator), matches haversineMiles
+const milesPerDegree = 3958.8 * math.Pi / 180
+
+// Zone is an alert area that a position can be tested against
+type Zone interface {
+	Contains(lat, lon float64) bool
+	// DistanceMiles is how far the point is outside the zone, 0 if it is inside
+	DistanceMiles(lat, lon float64) float64
+}
+
+// RadiusZone is everything within Miles of a center point
+type RadiusZone struct {
+	Lat, Lon float64
+	Miles    float64
+}
+
+func (z RadiusZone) Contains(lat, lon float64) bool {
+	return haversineMiles(z.Lat, z.Lon, lat, lon) <= z.Miles
+}
+
+func (z RadiusZone) DistanceMiles(lat, lon float64) float64 {
+	return math.Max(0, haversineMiles(z.Lat, z.Lon, lat, lon)-z.Miles)
+}
+
+// CorridorZone is everything within Miles of a polyline of [lon, lat] points, e.g. a highway
+type CorridorZone struct {
+	Path  [][]float64
+	Miles float64
+}
+
+func (z CorridorZone) Contains(lat, lon float64) bool {
+	return z.DistanceMiles(lat, lon) == 0
+}
+
+func (z CorridorZone) DistanceMiles(lat, lon float64) float64 {
+	return math.Max(0, pathDistanceMiles(lat, lon, z.Path)-z.Miles)
+}
+
+// pathDistanceMiles is the distance from a point to the closest part of a polyline of [lon, lat] points
+func pathDistanceMiles(lat, lon float64, path [][]float64) float64 {
+	if len(path) == 1 {
+		return haversineMiles(path[0][1], path[0][0], lat, lon)
+	}
+	closest := math.Inf(1)
+	for i := 1; i < len(path); i++ {
+		closest = math.Min(closest, segmentDistanceMiles(lat, lon, path[i-1], path[i]))
+	}
+	return closest
+}
+
+// segmentDistanceMiles is the distance from a point to the segment a-b ([lon, lat] each).
+// The segment is projected onto a flat plane around the point, which is accurate enough at corridor widths.
+func segmentDistanceMiles(lat, lon float64, a, b []float64) float64 {
+	scale := math.Cos(lat*math.Pi/180) * milesPerDegree
+	// b is placed relative to a, so a segment across the antimeridian doesn't wrap around the world
+	aLon := wrapLongitude(a[0] - lon)
+	bLon := aLon + wrapLongitude(b[0]-a[0])
+	ax, ay := aLon*scale, (a[1]-lat)*milesPerDegree
+	bx, by := bLon*scale, (b[1]-lat)*milesPerDegree
+
+	// Closest point on the segment to the origin (our point)
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lenSq))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// wrapLongitude brings a longitude difference into [-180, 180], so segments across the antimeridian stay short
+func wrapLongitude(d float64) float64 {
+	for d > 180 {
+		d -= 360
+	}
+	for d < -180 {
+		d += 360
+	}
+	return d
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+// Degrees of latitude for a distance in miles
+func milesNorth(miles float64) float64 {
+	return miles / milesPerDegree
+}
+
+func TestRadiusZone(t *testing.T) {
+	z := RadiusZone{Lat: 40, Lon: -90, Miles: 10}
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"center", 40, -90, true},
+		{"just inside", 40 + milesNorth(9.9), -90, true},
+		{"just outside", 40 + milesNorth(10.1), -90, false},
+		{"far away", 45, -80, false},
+	}
+	for _, tt := range tests {
+		if got := z.Contains(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", tt.name, tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestCorridorZone(t *testing.T) {
+	// An L shaped road, east along 40°N and then north along 89°W
+	z := CorridorZone{Path: [][]float64{{-90, 40}, {-89, 40}, {-89, 41}}, Miles: 5}
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"on the path", 40, -89.5, true},
+		{"on a vertex", 40, -89, true},
+		{"just inside the first leg", 40 - milesNorth(4.9), -89.5, true},
+		{"just outside the first leg", 40 - milesNorth(5.1), -89.5, false},
+		{"just inside past the end", 41 + milesNorth(4.9), -89, true},
+		{"just outside past the end", 41 + milesNorth(5.1), -89, false},
+		{"inside the corner", 40.5, -89.5, false},
+	}
+	for _, tt := range tests {
+		if got := z.Contains(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", tt.name, tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestCorridorZoneAcrossAntimeridian(t *testing.T) {
+	z := CorridorZone{Path: [][]float64{{179.5, 0}, {-179.5, 0}}, Miles: 5}
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     bool
+	}{
+		{"on the antimeridian", 0, 180, true},
+		{"west of it", 0, -179.8, true},
+		{"just outside", milesNorth(5.1), 180, false},
+		{"the other side of the world", 0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := z.Contains(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", tt.name, tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}